@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestAdjustBalance(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.registerAdmin("admin")
+	userID, user := s.register("alice")
+	path := fmt.Sprintf("/admin/users/%d/balance", userID)
+
+	// concurrent adjustments are added up, none of them is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.do(http.MethodPost, path, admin, map[string]any{"amount": 10, "reason": "refund"}, nil)
+		}()
+	}
+	wg.Wait()
+
+	var balance struct {
+		Balance int64 `json:"balance"`
+	}
+	s.mustDo(http.MethodGet, "/balance", user, nil, &balance)
+	if balance.Balance != 200 {
+		t.Errorf("balance after 20 adjustments of 10 = %d, want 200", balance.Balance)
+	}
+
+	if status := s.do(http.MethodPost, path, admin, map[string]any{"amount": -201, "reason": "chargeback"}, nil); status != http.StatusPreconditionFailed {
+		t.Errorf("adjustment to a negative balance: status %d, want 412", status)
+	}
+
+	var logs []struct {
+		Action   string `json:"action"`
+		TargetID int64  `json:"target_id"`
+		Amount   int64  `json:"amount"`
+	}
+	s.mustDo(http.MethodGet, "/admin/audit-logs", admin, nil, &logs)
+	if len(logs) != 20 {
+		t.Fatalf("%d audit logs, want one for each of the 20 adjustments and none for the refused one", len(logs))
+	}
+	for _, log := range logs {
+		if log.Action != "adjust_balance" || log.TargetID != userID || log.Amount != 10 {
+			t.Errorf("audit log = %+v", log)
+		}
+	}
+
+	// the notifications are sent by the subscribers of BalanceAdjusted
+	s.eventually("the balance notifications", func() bool {
+		return len(s.notifications(user)) == 20
+	})
+	if n := s.notifications(user)[0]; n.Kind != "balance_changed" {
+		t.Errorf("notification = %+v", n)
+	}
+}
+
+func TestRestoreItem(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.registerAdmin("admin")
+	_, seller := s.register("alice")
+	_, buyer := s.register("bob")
+	onSale := s.sell(seller, "leather jacket", 500)
+	sold := s.sell(seller, "wool sweater", 300)
+	s.mustDo(http.MethodPost, "/balance", buyer, map[string]int64{"balance": 1000}, nil)
+	s.mustDo(http.MethodPost, fmt.Sprintf("/purchase/%d", sold), buyer, nil, nil)
+
+	// moderated items are not found through the API
+	status := func(id int64) int {
+		var status int
+		if err := s.db.Read.QueryRow("SELECT status FROM items WHERE id = ?", id).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+	searchHits := func(q string) int {
+		var items []struct{}
+		s.mustDo(http.MethodGet, "/search?name="+q, "", nil, &items)
+		return len(items)
+	}
+	reason := map[string]string{"reason": "review"}
+
+	for _, id := range []int64{onSale, sold} {
+		s.mustDo(http.MethodPost, fmt.Sprintf("/admin/items/%d/takedown", id), admin, reason, nil)
+		if got := status(id); got != 4 {
+			t.Errorf("status of item %d after the takedown = %d, want moderated (4)", id, got)
+		}
+	}
+	// taken down again, it still goes back to the status before the first takedown
+	s.mustDo(http.MethodPost, fmt.Sprintf("/admin/items/%d/takedown", onSale), admin, reason, nil)
+	if n := searchHits("jacket"); n != 0 {
+		t.Errorf("%d search hits for a moderated item", n)
+	}
+
+	for id, want := range map[int64]int{onSale: 2, sold: 3} {
+		s.mustDo(http.MethodPost, fmt.Sprintf("/admin/items/%d/restore", id), admin, reason, nil)
+		// read through the item cache
+		var item struct {
+			Status int `json:"status"`
+		}
+		s.mustDo(http.MethodGet, fmt.Sprintf("/items/%d", id), "", nil, &item)
+		if item.Status != want {
+			t.Errorf("status of item %d after the restore = %d, want %d", id, item.Status, want)
+		}
+	}
+	if n := searchHits("jacket"); n != 1 {
+		t.Errorf("%d search hits for a restored item on sale, want 1", n)
+	}
+	if n := searchHits("sweater"); n != 0 {
+		t.Errorf("%d search hits for a restored item which is sold out, want 0", n)
+	}
+
+	if code := s.do(http.MethodPost, fmt.Sprintf("/admin/items/%d/restore", onSale), admin, reason, nil); code != http.StatusPreconditionFailed {
+		t.Errorf("restore of an item which is not under moderation: status %d, want 412", code)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.registerAdmin("admin")
+	sellerID, seller := s.register("alice")
+	reported := s.sell(seller, "leather jacket", 500)
+	takenDown := s.sell(seller, "wool sweater", 300)
+	onSale := s.sell(seller, "linen shirt", 200)
+	reason := map[string]string{"reason": "review"}
+
+	for i := 0; i < 3; i++ {
+		_, token := s.register(fmt.Sprintf("reporter%d", i))
+		s.mustDo(http.MethodPost, fmt.Sprintf("/items/%d/reports", reported), token, map[string]string{"reason": "fraud"}, nil)
+		if i == 0 {
+			s.mustDo(http.MethodPost, fmt.Sprintf("/items/%d/reports", onSale), token, map[string]string{"reason": "fraud"}, nil)
+		}
+	}
+	s.mustDo(http.MethodPost, fmt.Sprintf("/admin/items/%d/takedown", takenDown), admin, reason, nil)
+	s.mustDo(http.MethodPost, fmt.Sprintf("/admin/users/%d/suspend", sellerID), admin, reason, nil)
+
+	var flags struct {
+		Items []struct {
+			ID          int64 `json:"id"`
+			UserID      int64 `json:"user_id"`
+			Status      int   `json:"status"`
+			ReportCount int64 `json:"report_count"`
+		} `json:"items"`
+		Users []struct {
+			ID int64 `json:"id"`
+		} `json:"users"`
+	}
+	s.mustDo(http.MethodGet, "/admin/flags", admin, nil, &flags)
+	// the hidden items come first, the item which was reported once is not flagged
+	if got := fmt.Sprintf("%+v", flags.Items); got != fmt.Sprintf("[{ID:%d UserID:%d Status:5 ReportCount:3} {ID:%d UserID:%d Status:4 ReportCount:0}]", reported, sellerID, takenDown, sellerID) {
+		t.Errorf("flagged items = %s", got)
+	}
+	if len(flags.Users) != 1 || flags.Users[0].ID != sellerID {
+		t.Errorf("flagged users = %+v", flags.Users)
+	}
+
+	s.mustDo(http.MethodPost, fmt.Sprintf("/admin/items/%d/restore", takenDown), admin, reason, nil)
+	s.mustDo(http.MethodPost, fmt.Sprintf("/admin/users/%d/unsuspend", sellerID), admin, reason, nil)
+	// refused changes are not in the audit trail
+	if code := s.do(http.MethodPost, fmt.Sprintf("/admin/items/%d/restore", takenDown), admin, reason, nil); code != http.StatusPreconditionFailed {
+		t.Errorf("second restore: status %d, want 412", code)
+	}
+	if code := s.do(http.MethodPost, "/admin/users/999/suspend", admin, reason, nil); code != http.StatusNotFound {
+		t.Errorf("suspension of a missing user: status %d, want 404", code)
+	}
+
+	var logs []struct {
+		Action   string `json:"action"`
+		TargetID int64  `json:"target_id"`
+		Reason   string `json:"reason"`
+	}
+	s.mustDo(http.MethodGet, "/admin/audit-logs", admin, nil, &logs)
+	want := fmt.Sprintf("[{Action:unsuspend_user TargetID:%[1]d Reason:review} {Action:restore_item TargetID:%[2]d Reason:review} {Action:suspend_user TargetID:%[1]d Reason:review} {Action:take_down_item TargetID:%[2]d Reason:review}]", sellerID, takenDown)
+	if got := fmt.Sprintf("%+v", logs); got != want {
+		t.Errorf("audit logs = %s, want %s", got, want)
+	}
+}
+
+func TestAdminRole(t *testing.T) {
+	s := newTestServer(t)
+	adminID, admin := s.registerAdmin("admin")
+	_, alice := s.register("alice")
+
+	// an admin can moderate the items of other users but not sell them in the name of the seller
+	req := s.multipartRequest(http.MethodPost, "/items", map[string]string{
+		"name":        "draft",
+		"category_id": "1",
+		"price":       "100",
+		"description": "a draft of alice",
+	}, "image", pngHeader)
+	var item struct {
+		ID int64 `json:"id"`
+	}
+	if status := s.send(req, alice, &item); status != http.StatusOK {
+		t.Fatalf("POST /items: status %d", status)
+	}
+	if status := s.do(http.MethodPost, "/sell", admin, map[string]int64{"item_id": item.ID}, nil); status != http.StatusForbidden {
+		t.Errorf("admin selling the draft of alice: status %d, want 403", status)
+	}
+
+	if status := s.do(http.MethodGet, "/admin/audit-logs", admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("GET /admin/audit-logs as admin: status %d", status)
+	}
+	// the role is read from the user row, so the token of a demoted admin loses access at once
+	if _, err := s.db.Write.Exec("UPDATE users SET role = 'user' WHERE id = ?", adminID); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.do(http.MethodGet, "/admin/audit-logs", admin, nil, nil); status != http.StatusForbidden {
+		t.Errorf("GET /admin/audit-logs after the demotion: status %d, want 403", status)
+	}
+}
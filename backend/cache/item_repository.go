@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// Counter counts the lookups of a cache.
+type Counter struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type counter struct {
+	hits, misses atomic.Uint64
+}
+
+func (c *counter) hit()  { c.hits.Add(1) }
+func (c *counter) miss() { c.misses.Add(1) }
+
+func (c *counter) load() Counter {
+	return Counter{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+type Stats struct {
+	Items      Counter `json:"items"`
+	ItemsLen   int     `json:"items_len"`
+	Categories Counter `json:"categories"`
+}
+
+// ItemRepository caches the categories and the details of recently read items in front of a db.ItemRepository.
+// Every other method goes to the repository as is.
+// The items are kept, and returned by GetItem, without the image so that their size is small and known. GetItemImage reads it from the DB.
+//
+// Items are invalidated by the item writes of this repository, and the categories by the category writes of this repository.
+// Writes which bypass it, e.g. /initialize, must call Purge.
+type ItemRepository struct {
+	db.ItemRepository
+
+	items     *LRU[int64, domain.Item]
+	itemStats counter
+
+	mu           sync.RWMutex
+	categories   []domain.Category
+	categoryByID map[int64]domain.Category
+	// purges counts the calls of Purge, see GetCategories.
+	purges        uint64
+	categoryStats counter
+}
+
+// NewItemRepository keeps up to size items for ttl. A size of 0 disables the item cache.
+func NewItemRepository(repo db.ItemRepository, size int, ttl time.Duration) *ItemRepository {
+	return &ItemRepository{
+		ItemRepository: repo,
+		items:          NewLRU[int64, domain.Item](size, ttl),
+	}
+}
+
+func (r *ItemRepository) GetItem(ctx context.Context, id int64) (domain.Item, error) {
+	if item, ok := r.items.Get(id); ok {
+		r.itemStats.hit()
+		return item, nil
+	}
+	r.itemStats.miss()
+
+	version := r.items.Version()
+	item, err := r.ItemRepository.GetItem(ctx, id)
+	if err != nil {
+		return item, err
+	}
+	item.Image = nil
+	r.items.AddIfVersion(id, item, version)
+	return item, nil
+}
+
+func (r *ItemRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
+	item, err := r.ItemRepository.AddItem(ctx, item)
+	if err != nil {
+		return item, err
+	}
+	r.items.Remove(item.ID)
+	return item, nil
+}
+
+func (r *ItemRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+	// removed even on an error since the update might have been applied anyway
+	defer r.items.Remove(id)
+	return r.ItemRepository.UpdateItemStatus(ctx, id, status)
+}
+
+func (r *ItemRepository) Moderate(ctx context.Context, id int64, status domain.ItemStatus, log domain.AuditLog) error {
+	defer r.items.Remove(id)
+	return r.ItemRepository.Moderate(ctx, id, status, log)
+}
+
+func (r *ItemRepository) Restore(ctx context.Context, id int64, log domain.AuditLog) (domain.ItemStatus, error) {
+	defer r.items.Remove(id)
+	return r.ItemRepository.Restore(ctx, id, log)
+}
+
+func (r *ItemRepository) Report(ctx context.Context, report domain.Report, limits domain.ReportLimits) (bool, error) {
+	defer r.items.Remove(report.ItemID)
+	return r.ItemRepository.Report(ctx, report, limits)
+}
+
+func (r *ItemRepository) ListItem(ctx context.Context, id int64) error {
+	defer r.items.Remove(id)
+	return r.ItemRepository.ListItem(ctx, id)
+}
+
+func (r *ItemRepository) Purchase(ctx context.Context, id int64, buyerID int64) error {
+	defer r.items.Remove(id)
+	return r.ItemRepository.Purchase(ctx, id, buyerID)
+}
+
+func (r *ItemRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
+	r.mu.RLock()
+	cat, ok := r.categoryByID[id]
+	loaded := r.categoryByID != nil
+	r.mu.RUnlock()
+	if ok {
+		r.categoryStats.hit()
+		return cat, nil
+	}
+	if loaded {
+		// the categories are all in memory, so the category doesn't exist
+		r.categoryStats.hit()
+		return domain.Category{}, domain.NewNotFoundError("category not found")
+	}
+
+	if _, err := r.GetCategories(ctx); err != nil {
+		return domain.Category{}, err
+	}
+	r.mu.RLock()
+	cat, ok = r.categoryByID[id]
+	r.mu.RUnlock()
+	if !ok {
+		// not kept because of a concurrent Purge, or missing
+		return r.ItemRepository.GetCategory(ctx, id)
+	}
+	return cat, nil
+}
+
+// GetCategories returns a copy of the categories, which are loaded on the first call.
+func (r *ItemRepository) GetCategories(ctx context.Context) ([]domain.Category, error) {
+	r.mu.RLock()
+	cats, loaded, purges := r.categories, r.categoryByID != nil, r.purges
+	r.mu.RUnlock()
+	if loaded {
+		r.categoryStats.hit()
+		return append([]domain.Category(nil), cats...), nil
+	}
+	r.categoryStats.miss()
+
+	cats, err := r.ItemRepository.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]domain.Category, len(cats))
+	for _, cat := range cats {
+		byID[cat.ID] = cat
+	}
+
+	r.mu.Lock()
+	// categories loaded before a concurrent Purge may be stale
+	if r.purges == purges {
+		r.categories, r.categoryByID = cats, byID
+	}
+	r.mu.Unlock()
+	return append([]domain.Category(nil), cats...), nil
+}
+
+func (r *ItemRepository) AddCategory(ctx context.Context, cat domain.Category, log domain.AuditLog) (domain.Category, error) {
+	defer r.purgeCategories()
+	return r.ItemRepository.AddCategory(ctx, cat, log)
+}
+
+func (r *ItemRepository) RenameCategory(ctx context.Context, id int64, name string, log domain.AuditLog) error {
+	defer r.purgeCategories()
+	return r.ItemRepository.RenameCategory(ctx, id, name, log)
+}
+
+func (r *ItemRepository) MoveCategory(ctx context.Context, id int64, parentID int64, log domain.AuditLog) error {
+	defer r.purgeCategories()
+	return r.ItemRepository.MoveCategory(ctx, id, parentID, log)
+}
+
+func (r *ItemRepository) DeleteCategory(ctx context.Context, id int64, log domain.AuditLog) error {
+	defer r.purgeCategories()
+	return r.ItemRepository.DeleteCategory(ctx, id, log)
+}
+
+// Purge drops everything in memory. It is called after the DB was changed without going through the cache.
+func (r *ItemRepository) Purge() {
+	r.items.Purge()
+	r.purgeCategories()
+}
+
+func (r *ItemRepository) purgeCategories() {
+	r.mu.Lock()
+	r.categories, r.categoryByID = nil, nil
+	r.purges++
+	r.mu.Unlock()
+}
+
+func (r *ItemRepository) Stats() Stats {
+	return Stats{
+		Items:      r.itemStats.load(),
+		ItemsLen:   r.items.Len(),
+		Categories: r.categoryStats.load(),
+	}
+}
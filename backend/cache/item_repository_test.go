@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// fakeItemRepository keeps the items in a map and counts the reads of GetItem.
+// The methods it doesn't override panic.
+type fakeItemRepository struct {
+	db.ItemRepository
+
+	items map[int64]domain.Item
+	reads int
+	// onRead is called by GetItem after the item was read, to change it concurrently
+	onRead func()
+}
+
+func (r *fakeItemRepository) GetItem(ctx context.Context, id int64) (domain.Item, error) {
+	r.reads++
+	item, ok := r.items[id]
+	if r.onRead != nil {
+		r.onRead()
+	}
+	if !ok {
+		return item, domain.NewNotFoundError("item not found")
+	}
+	return item, nil
+}
+
+func (r *fakeItemRepository) GetItemImage(ctx context.Context, id int64) ([]byte, error) {
+	return r.items[id].Image, nil
+}
+
+func (r *fakeItemRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+	item := r.items[id]
+	item.Status = status
+	r.items[id] = item
+	return nil
+}
+
+func TestItemRepositoryImage(t *testing.T) {
+	ctx := context.Background()
+	image := make([]byte, 1<<20)
+	fake := &fakeItemRepository{items: map[int64]domain.Item{1: {ID: 1, Name: "shirt", Image: image, Status: domain.ItemStatusOnSale}}}
+	r := NewItemRepository(fake, 10, time.Minute)
+
+	// the image is left out on a miss as well as on a hit, so callers can't come to depend on it
+	for i := 0; i < 2; i++ {
+		item, err := r.GetItem(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Image != nil || item.Name != "shirt" {
+			t.Errorf("read %d: item = {Name: %q, %d bytes of image}", i+1, item.Name, len(item.Image))
+		}
+	}
+	if fake.reads != 1 {
+		t.Errorf("%d reads of the repository, want 1", fake.reads)
+	}
+	if got := r.Stats().Items; got.Hits != 1 || got.Misses != 1 {
+		t.Errorf("item stats = %+v", got)
+	}
+
+	got, err := r.GetItemImage(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(image) {
+		t.Errorf("image of %d bytes, want %d", len(got), len(image))
+	}
+}
+
+func TestItemRepositoryInvalidation(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeItemRepository{items: map[int64]domain.Item{1: {ID: 1, Status: domain.ItemStatusOnSale}}}
+	r := NewItemRepository(fake, 10, time.Minute)
+
+	if _, err := r.GetItem(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateItemStatus(ctx, 1, domain.ItemStatusSoldOut); err != nil {
+		t.Fatal(err)
+	}
+	item, err := r.GetItem(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Status != domain.ItemStatusSoldOut {
+		t.Errorf("status after the update = %d, want sold out", item.Status)
+	}
+}
+
+func TestItemRepositoryConcurrentInvalidation(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeItemRepository{items: map[int64]domain.Item{1: {ID: 1, Status: domain.ItemStatusOnSale}}}
+	r := NewItemRepository(fake, 10, time.Minute)
+
+	// the item is sold between the read of a miss and its caching
+	fake.onRead = func() {
+		fake.onRead = nil
+		if err := r.UpdateItemStatus(ctx, 1, domain.ItemStatusSoldOut); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if item, err := r.GetItem(ctx, 1); err != nil || item.Status != domain.ItemStatusOnSale {
+		t.Fatalf("item read before the update = %+v, %v", item, err)
+	}
+
+	item, err := r.GetItem(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Status != domain.ItemStatusSoldOut {
+		t.Errorf("status after the concurrent update = %d, want sold out", item.Status)
+	}
+	if fake.reads != 2 {
+		t.Errorf("%d reads of the repository, want 2 as the first read was not cached", fake.reads)
+	}
+}
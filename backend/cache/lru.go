@@ -0,0 +1,130 @@
+// Package cache keeps hot data of the repositories in memory.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a fixed size cache whose entries also expire after a TTL.
+// It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[K]*list.Element
+	// version changes on every removal, see AddIfVersion.
+	version uint64
+	now     func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func NewLRU[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[K]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value of key unless it is missing or expired.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Version returns a value which changes whenever an entry is removed.
+func (c *LRU[K, V]) Version() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// AddIfVersion adds the value unless something was removed since version was taken.
+// A value loaded before a concurrent invalidation is then dropped instead of being cached stale until it expires.
+func (c *LRU[K, V]) AddIfVersion(key K, value V, version uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.version != version {
+		return false
+	}
+	c.add(key, value)
+	return true
+}
+
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, value)
+}
+
+func (c *LRU[K, V]) add(key K, value V) {
+	if c.size <= 0 {
+		return
+	}
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expiresAt = value, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	c.version++
+}
+
+// Purge removes every entry.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.entries = make(map[K]*list.Element)
+	c.version++
+}
+
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*entry[K, V]).key)
+}
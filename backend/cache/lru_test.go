@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLRU returns a cache whose clock only moves with the returned func.
+func newTestLRU(size int, ttl time.Duration) (*LRU[int, string], func(time.Duration)) {
+	c := NewLRU[int, string](size, ttl)
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLRUEviction(t *testing.T) {
+	c, _ := newTestLRU(2, time.Minute)
+	c.Add(1, "a")
+	c.Add(2, "b")
+	// 1 is used more recently than 2, so 2 makes room for 3
+	c.Get(1)
+	c.Add(3, "c")
+
+	if _, ok := c.Get(2); ok {
+		t.Error("the least recently used entry was kept")
+	}
+	for key, want := range map[int]string{1: "a", 3: "c"} {
+		if got, ok := c.Get(key); !ok || got != want {
+			t.Errorf("Get(%d) = %q, %t", key, got, ok)
+		}
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c, advance := newTestLRU(2, time.Minute)
+	c.Add(1, "a")
+	advance(time.Minute - time.Second)
+	if _, ok := c.Get(1); !ok {
+		t.Fatal("the entry expired before its TTL")
+	}
+	advance(time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Fatal("the entry was served after its TTL")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len() after the expiry = %d, want 0", n)
+	}
+}
+
+func TestLRUAddIfVersion(t *testing.T) {
+	c, _ := newTestLRU(2, time.Minute)
+
+	// a value loaded while the key was invalidated is not cached
+	version := c.Version()
+	c.Remove(1)
+	if c.AddIfVersion(1, "stale", version) {
+		t.Error("added a value loaded before a Remove")
+	}
+	if _, ok := c.Get(1); ok {
+		t.Error("the stale value is cached")
+	}
+
+	version = c.Version()
+	c.Purge()
+	if c.AddIfVersion(1, "stale", version) {
+		t.Error("added a value loaded before a Purge")
+	}
+
+	version = c.Version()
+	if !c.AddIfVersion(1, "fresh", version) {
+		t.Fatal("a value loaded without an invalidation was not added")
+	}
+	if got, ok := c.Get(1); !ok || got != "fresh" {
+		t.Errorf("Get(1) = %q, %t", got, ok)
+	}
+}
+
+func TestLRUDisabled(t *testing.T) {
+	c, _ := newTestLRU(0, time.Minute)
+	c.Add(1, "a")
+	if _, ok := c.Get(1); ok || c.Len() != 0 {
+		t.Error("a cache of size 0 kept an entry")
+	}
+}
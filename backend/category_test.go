@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCategoryAdmin(t *testing.T) {
+	s := newTestServer(t)
+	adminID, admin := s.registerAdmin("admin")
+	_, seller := s.register("seller")
+
+	add := func(name string, parentID int64) int64 {
+		t.Helper()
+		var cat struct {
+			ID int64 `json:"id"`
+		}
+		s.mustDo(http.MethodPost, "/admin/categories", admin, map[string]any{"name": name, "parent_id": parentID}, &cat)
+		return cat.ID
+	}
+	// clothes > jackets > leather, and the item of the seller in fashion (1)
+	clothes := add("clothes", 0)
+	jackets := add("jackets", clothes)
+	leather := add("leather", jackets)
+	s.sell(seller, "leather jacket", 500)
+	movePath := func(id int64) string { return fmt.Sprintf("/admin/categories/%d/move", id) }
+
+	for _, tt := range []struct {
+		name     string
+		id       int64
+		parentID int64
+		want     int
+	}{
+		{"under itself", clothes, clothes, http.StatusPreconditionFailed},
+		{"under its child", clothes, jackets, http.StatusPreconditionFailed},
+		{"under its grandchild", clothes, leather, http.StatusPreconditionFailed},
+		{"under a missing category", jackets, 12345, http.StatusPreconditionFailed},
+		{"missing category", 12345, clothes, http.StatusNotFound},
+		{"to the root", leather, 0, http.StatusOK},
+		// the former grandchild isn't a descendant any more
+		{"under the former grandchild", clothes, leather, http.StatusOK},
+	} {
+		if status := s.do(http.MethodPost, movePath(tt.id), admin, map[string]int64{"parent_id": tt.parentID}, nil); status != tt.want {
+			t.Errorf("move %s: status %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	deletePath := func(id int64) string { return fmt.Sprintf("/admin/categories/%d", id) }
+	for _, tt := range []struct {
+		name string
+		id   int64
+		want int
+	}{
+		{"with children", clothes, http.StatusConflict},
+		{"with items", 1, http.StatusConflict},
+		{"missing", 12345, http.StatusNotFound},
+		{"leaf", jackets, http.StatusOK},
+		{"emptied", clothes, http.StatusOK},
+	} {
+		if status := s.do(http.MethodDelete, deletePath(tt.id), admin, nil, nil); status != tt.want {
+			t.Errorf("delete the category %s: status %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	// a log for each change and none for the refused ones, the newest first
+	var logs []struct {
+		AdminID    int64  `json:"admin_id"`
+		Action     string `json:"action"`
+		TargetType string `json:"target_type"`
+		TargetID   int64  `json:"target_id"`
+	}
+	s.mustDo(http.MethodGet, "/admin/audit-logs", admin, nil, &logs)
+	want := []struct {
+		action   string
+		targetID int64
+	}{
+		{"delete_category", clothes},
+		{"delete_category", jackets},
+		{"move_category", clothes},
+		{"move_category", leather},
+		{"create_category", leather},
+		{"create_category", jackets},
+		{"create_category", clothes},
+	}
+	if len(logs) != len(want) {
+		t.Fatalf("%d audit logs, want %d: %+v", len(logs), len(want), logs)
+	}
+	for i, log := range logs {
+		if log.AdminID != adminID || log.TargetType != "category" || log.Action != want[i].action || log.TargetID != want[i].targetID {
+			t.Errorf("audit log %d = %+v, want %s of %d", i, log, want[i].action, want[i].targetID)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type testComments struct {
+	Comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	} `json:"comments"`
+	NextCursor int64 `json:"next_cursor"`
+}
+
+func TestCommentPagination(t *testing.T) {
+	s := newTestServer(t)
+	_, seller := s.register("seller")
+	_, alice := s.register("alice")
+	id := s.sell(seller, "leather jacket", 500)
+	path := fmt.Sprintf("/items/%d/comments", id)
+
+	post := func(body string) {
+		s.mustDo(http.MethodPost, path, alice, map[string]string{"body": body}, nil)
+	}
+	page := func(query string) testComments {
+		t.Helper()
+		var res testComments
+		s.mustDo(http.MethodGet, path+query, "", nil, &res)
+		return res
+	}
+	bodies := func(res testComments) []string {
+		var bodies []string
+		for _, c := range res.Comments {
+			bodies = append(bodies, c.Body)
+		}
+		return bodies
+	}
+
+	if res := page(""); len(res.Comments) != 0 || res.NextCursor != 0 {
+		t.Errorf("comments of an item without any = %+v", res)
+	}
+
+	for i := 1; i <= 3; i++ {
+		post(fmt.Sprint(i))
+	}
+	// exactly limit comments are the last page
+	if res := page("?limit=3"); len(res.Comments) != 3 || res.NextCursor != 0 {
+		t.Errorf("3 comments with limit 3 = %v, next_cursor %d, want no next page", bodies(res), res.NextCursor)
+	}
+
+	post("4")
+	first := page("?limit=3")
+	if fmt.Sprint(bodies(first)) != "[1 2 3]" || first.NextCursor != first.Comments[2].ID {
+		t.Fatalf("first page = %v, next_cursor %d", bodies(first), first.NextCursor)
+	}
+	second := page(fmt.Sprintf("?limit=3&cursor=%d", first.NextCursor))
+	if fmt.Sprint(bodies(second)) != "[4]" || second.NextCursor != 0 {
+		t.Errorf("second page = %v, next_cursor %d", bodies(second), second.NextCursor)
+	}
+	// the cursor of a full last page has an empty page after it
+	if res := page(fmt.Sprintf("?limit=1&cursor=%d", second.Comments[0].ID)); len(res.Comments) != 0 || res.NextCursor != 0 {
+		t.Errorf("page after the last comment = %v, next_cursor %d", bodies(res), res.NextCursor)
+	}
+
+	for _, query := range []string{"?cursor=0", "?cursor=x", "?limit=0", "?limit=101"} {
+		if code := s.do(http.MethodGet, path+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET comments%s: status %d, want 400", query, code)
+		}
+	}
+}
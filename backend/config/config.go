@@ -0,0 +1,317 @@
+// Package config loads the settings of the server.
+// Values are taken from the defaults, then the optional YAML file at CONFIG_FILE (config.yaml), then environment variables.
+package config
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/bytes"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/ratelimit"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultFile = "config.yaml"
+
+// devSecret is the well-known secret of config.example.yaml. It is accepted only in dev mode,
+// where it is also the default, since anyone can forge tokens with it.
+const devSecret = "secret-key"
+
+type Config struct {
+	// Dev allows the insecure defaults meant for local development, e.g. the secret of config.example.yaml.
+	Dev       bool             `yaml:"dev"`
+	Server    Server           `yaml:"server"`
+	DB        DB               `yaml:"db"`
+	Auth      Auth             `yaml:"auth"`
+	Mail      Mail             `yaml:"mail"`
+	Cache     Cache            `yaml:"cache"`
+	RateLimit ratelimit.Config `yaml:"rate_limit"`
+	Webhook   Webhook          `yaml:"webhook"`
+	Report    Report           `yaml:"report"`
+}
+
+type Server struct {
+	// Addr is the address to listen on, e.g. ":9000".
+	Addr string `yaml:"addr"`
+	// BodyLimit is the max request body size, e.g. "5M".
+	BodyLimit     string `yaml:"body_limit"`
+	FrontURL      string `yaml:"front_url"`
+	AccessLogFile string `yaml:"access_log_file"`
+	// ShutdownDelay keeps serving after /readyz turned unready so that load balancers notice it before the listener closes.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// ShutdownTimeout bounds the time to wait for in-flight requests and background workers.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the CIDRs of the reverse proxies whose X-Forwarded-For is believed for the client IP.
+	// When it is empty the client IP is the peer address, as anyone can send the header.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type DB struct {
+	Path string `yaml:"path"`
+	// SQLDir has the schema and the data loaded by /initialize.
+	SQLDir string `yaml:"sql_dir"`
+	// JournalMode is the journal_mode pragma. WAL lets readers run while a write is in progress.
+	JournalMode string `yaml:"journal_mode"`
+	// BusyTimeout is how long a connection waits for a lock before failing with SQLITE_BUSY.
+	BusyTimeout time.Duration `yaml:"busy_timeout"`
+	// Synchronous is the synchronous pragma. NORMAL is durable enough in WAL mode and saves an fsync per commit.
+	Synchronous string `yaml:"synchronous"`
+	ForeignKeys bool   `yaml:"foreign_keys"`
+	// MaxReadConns is the size of the read-only pool. Writes always go through a single connection.
+	MaxReadConns int `yaml:"max_read_conns"`
+}
+
+type Auth struct {
+	Secret   string        `yaml:"secret"`
+	TokenTTL time.Duration `yaml:"token_ttl"`
+}
+
+// Mail sends mails through SMTPAddr when it is set, otherwise writes them to LogFile.
+type Mail struct {
+	SMTPAddr     string `yaml:"smtp_addr"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`
+	LogFile      string `yaml:"log_file"`
+}
+
+// Cache is the in-memory cache of categories and item details.
+type Cache struct {
+	// Items is the max number of item details kept in memory. 0 disables the item cache.
+	// The images are not cached, so an entry is about the size of the name and the description.
+	Items int `yaml:"items"`
+	// ItemTTL bounds how long an item is served from memory, since only the writes of this process invalidate it.
+	ItemTTL time.Duration `yaml:"item_ttl"`
+}
+
+// Webhook is how the events are sent to the webhooks. A delivery is given up about 20 minutes after the event with the defaults.
+type Webhook struct {
+	// Timeout bounds each request to an endpoint, including reading the response.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is the number of failed attempts after which a delivery is moved to the dead letter state.
+	MaxAttempts int `yaml:"max_attempts"`
+	// BaseBackoff is the delay after the first failed attempt. It doubles with each attempt up to MaxBackoff.
+	BaseBackoff time.Duration `yaml:"base_backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+	// AllowedPrivateNetworks are the CIDRs of loopback, private and link-local addresses which the webhooks may connect to anyway,
+	// e.g. [127.0.0.0/8] for a receiver on the local machine. Any other address of those ranges is refused.
+	AllowedPrivateNetworks []string `yaml:"allowed_private_networks"`
+}
+
+// Report limits the reports of items by users.
+type Report struct {
+	// Limit is the number of reports a user can file within Window.
+	Limit  int64         `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+	// HideThreshold is the number of distinct users reporting an item since it was last reviewed which hides it until it is reviewed again.
+	HideThreshold int64 `yaml:"hide_threshold"`
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:            ":9000",
+			BodyLimit:       "5M",
+			FrontURL:        "http://localhost:3000",
+			AccessLogFile:   "access.log",
+			ShutdownDelay:   0,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		DB: DB{
+			Path:         "db/mercari.sqlite3",
+			SQLDir:       "sql",
+			JournalMode:  "WAL",
+			BusyTimeout:  5 * time.Second,
+			Synchronous:  "NORMAL",
+			ForeignKeys:  true,
+			MaxReadConns: 4,
+		},
+		Auth: Auth{
+			TokenTTL: 72 * time.Hour,
+		},
+		Mail: Mail{
+			From:    "noreply@localhost",
+			LogFile: "mail.log",
+		},
+		Cache: Cache{
+			Items:   256,
+			ItemTTL: 30 * time.Second,
+		},
+		RateLimit: ratelimit.DefaultConfig(),
+		Webhook: Webhook{
+			Timeout:     5 * time.Second,
+			MaxAttempts: 8,
+			BaseBackoff: 10 * time.Second,
+			MaxBackoff:  time.Hour,
+		},
+		Report: Report{
+			Limit:         10,
+			Window:        time.Hour,
+			HideThreshold: 3,
+		},
+	}
+}
+
+// Load reads the config and validates it.
+func Load() (Config, error) {
+	cfg := Default()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = defaultFile
+	}
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, err
+	}
+	if cfg.Dev && cfg.Auth.Secret == "" {
+		cfg.Auth.Secret = devSecret
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile overwrites cfg with the values in the file. A missing file is an error only when it was set explicitly.
+// Unknown keys are rejected so that a misspelled setting doesn't silently keep its default.
+func (c *Config) loadFile(path string, required bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read config file")
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	// an empty file is the same as none
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	vars := map[string]*string{
+		"ADDR":          &c.Server.Addr,
+		"BODY_LIMIT":    &c.Server.BodyLimit,
+		"FRONT_URL":     &c.Server.FrontURL,
+		"LOGFILE":       &c.Server.AccessLogFile,
+		"DB_PATH":       &c.DB.Path,
+		"SQL_DIR":       &c.DB.SQLDir,
+		"SECRET":        &c.Auth.Secret,
+		"SMTP_ADDR":     &c.Mail.SMTPAddr,
+		"SMTP_USERNAME": &c.Mail.SMTPUsername,
+		"SMTP_PASSWORD": &c.Mail.SMTPPassword,
+		"MAIL_FROM":     &c.Mail.From,
+		"MAIL_LOGFILE":  &c.Mail.LogFile,
+	}
+	for key, p := range vars {
+		if v := os.Getenv(key); v != "" {
+			*p = v
+		}
+	}
+
+	if v := os.Getenv("DEV"); v != "" {
+		dev, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrap(err, "invalid DEV")
+		}
+		c.Dev = dev
+	}
+	if v := os.Getenv("TOKEN_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "invalid TOKEN_TTL")
+		}
+		c.Auth.TokenTTL = d
+	}
+	return nil
+}
+
+// Validate reports the first invalid value so that the server fails at startup instead of at the first request.
+func (c Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		return errors.Wrap(err, "invalid server.addr")
+	}
+	if _, err := bytes.Parse(c.Server.BodyLimit); err != nil {
+		return errors.Wrap(err, "invalid server.body_limit")
+	}
+	if c.Server.ShutdownDelay < 0 || c.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("server.shutdown_delay must not be negative and server.shutdown_timeout must be positive")
+	}
+	for _, cidr := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.Wrap(err, "invalid server.trusted_proxies")
+		}
+	}
+	if c.Server.AccessLogFile == "" {
+		return fmt.Errorf("server.access_log_file is required")
+	}
+	if c.DB.Path == "" || c.DB.SQLDir == "" {
+		return fmt.Errorf("db.path and db.sql_dir are required")
+	}
+	if !oneOf(strings.ToUpper(c.DB.JournalMode), "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF") {
+		return fmt.Errorf("invalid db.journal_mode %q", c.DB.JournalMode)
+	}
+	if !oneOf(strings.ToUpper(c.DB.Synchronous), "OFF", "NORMAL", "FULL", "EXTRA") {
+		return fmt.Errorf("invalid db.synchronous %q", c.DB.Synchronous)
+	}
+	if c.DB.BusyTimeout < 0 {
+		return fmt.Errorf("db.busy_timeout must not be negative")
+	}
+	if c.DB.MaxReadConns <= 0 {
+		return fmt.Errorf("db.max_read_conns must be positive")
+	}
+	if c.Auth.Secret == "" {
+		return fmt.Errorf("auth.secret is required, set it to a long random string")
+	}
+	if c.Auth.Secret == devSecret && !c.Dev {
+		return fmt.Errorf("auth.secret must not be the secret of config.example.yaml outside dev mode")
+	}
+	if c.Auth.TokenTTL <= 0 {
+		return fmt.Errorf("auth.token_ttl must be positive")
+	}
+	if c.Mail.SMTPAddr == "" && c.Mail.LogFile == "" {
+		return fmt.Errorf("either mail.smtp_addr or mail.log_file is required")
+	}
+	if c.Cache.Items < 0 || (c.Cache.Items > 0 && c.Cache.ItemTTL <= 0) {
+		return fmt.Errorf("cache.items must not be negative and cache.item_ttl must be positive")
+	}
+	if err := c.RateLimit.Validate(); err != nil {
+		return errors.Wrap(err, "invalid rate_limit")
+	}
+	if c.Webhook.Timeout <= 0 || c.Webhook.MaxAttempts <= 0 {
+		return fmt.Errorf("webhook.timeout and webhook.max_attempts must be positive")
+	}
+	if c.Webhook.BaseBackoff <= 0 || c.Webhook.MaxBackoff < c.Webhook.BaseBackoff {
+		return fmt.Errorf("webhook.base_backoff must be positive and webhook.max_backoff must not be less than it")
+	}
+	for _, cidr := range c.Webhook.AllowedPrivateNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.Wrap(err, "invalid webhook.allowed_private_networks")
+		}
+	}
+	if c.Report.Limit <= 0 || c.Report.Window <= 0 || c.Report.HideThreshold <= 0 {
+		return fmt.Errorf("report.limit, report.window and report.hide_threshold must be positive")
+	}
+	return nil
+}
+
+func oneOf(v string, candidates ...string) bool {
+	for _, c := range candidates {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
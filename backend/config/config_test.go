@@ -0,0 +1,169 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file and points CONFIG_FILE to it.
+func writeFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoad(t *testing.T) {
+	writeFile(t, `
+server:
+  addr: ":8000"
+  front_url: http://example.com
+auth:
+  secret: secret-of-the-file
+  token_ttl: 1h
+report:
+  limit: 5
+`)
+	t.Setenv("ADDR", ":7000")
+	t.Setenv("TOKEN_TTL", "2h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want any
+	}{
+		{"env over file", cfg.Server.Addr, ":7000"},
+		{"duration from env over file", cfg.Auth.TokenTTL, 2 * time.Hour},
+		{"file over default", cfg.Server.FrontURL, "http://example.com"},
+		{"file over default", cfg.Auth.Secret, "secret-of-the-file"},
+		{"nested file over default", cfg.Report.Limit, int64(5)},
+		{"default kept in a section of the file", cfg.Report.Window, time.Hour},
+		{"default", cfg.DB.MaxReadConns, 4},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"unknown key", "auth:\n  secret: s3cr3t\n  sercet: typo\n", nil, "field sercet not found"},
+		{"unknown section", "auth:\n  secret: s3cr3t\nreports:\n  limit: 1\n", nil, "field reports not found"},
+		{"malformed duration", "auth:\n  secret: s3cr3t\n  token_ttl: forever\n", nil, "failed to parse config file"},
+		{"malformed env", "auth:\n  secret: s3cr3t\n", map[string]string{"TOKEN_TTL": "forever"}, "invalid TOKEN_TTL"},
+		{"no secret", "", nil, "auth.secret is required"},
+		{"example secret", "auth:\n  secret: secret-key\n", nil, "must not be the secret of config.example.yaml"},
+		{"invalid value", "auth:\n  secret: s3cr3t\nreport:\n  limit: 0\n", nil, "report.limit"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFile(t, tt.file)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := Load(); err == nil {
+		t.Error("no error for a missing CONFIG_FILE")
+	}
+
+	// without CONFIG_FILE config.yaml is optional
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	os.Unsetenv("CONFIG_FILE")
+	t.Setenv("SECRET", "s3cr3t")
+	if _, err := Load(); err != nil {
+		t.Errorf("Load() without config.yaml: %s", err)
+	}
+}
+
+func TestLoadDev(t *testing.T) {
+	writeFile(t, "dev: true\n")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.Secret != devSecret {
+		t.Errorf("secret in dev mode = %q, want the one of config.example.yaml", cfg.Auth.Secret)
+	}
+
+	t.Setenv("DEV", "false")
+	if _, err := Load(); err == nil {
+		t.Error("DEV=false didn't turn off the dev mode of the file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := Default()
+		cfg.Auth.Secret = "s3cr3t"
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("the default config with a secret is invalid: %s", err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		change  func(*Config)
+		wantErr string
+	}{
+		{"addr without port", func(c *Config) { c.Server.Addr = "localhost" }, "server.addr"},
+		{"body limit", func(c *Config) { c.Server.BodyLimit = "lots" }, "server.body_limit"},
+		{"negative shutdown delay", func(c *Config) { c.Server.ShutdownDelay = -time.Second }, "server.shutdown_delay"},
+		{"trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1"} }, "server.trusted_proxies"},
+		{"journal mode", func(c *Config) { c.DB.JournalMode = "fast" }, "db.journal_mode"},
+		{"synchronous", func(c *Config) { c.DB.Synchronous = "sometimes" }, "db.synchronous"},
+		{"read conns", func(c *Config) { c.DB.MaxReadConns = 0 }, "db.max_read_conns"},
+		{"empty secret in dev mode", func(c *Config) { c.Dev, c.Auth.Secret = true, "" }, "auth.secret is required"},
+		{"token ttl", func(c *Config) { c.Auth.TokenTTL = 0 }, "auth.token_ttl"},
+		{"no mail", func(c *Config) { c.Mail.LogFile = "" }, "mail.smtp_addr"},
+		{"item ttl", func(c *Config) { c.Cache.ItemTTL = 0 }, "cache.item_ttl"},
+		{"rate limit", func(c *Config) { c.RateLimit.Public.Burst = 0 }, "rate_limit"},
+		{"webhook backoff", func(c *Config) { c.Webhook.MaxBackoff = time.Second }, "webhook.max_backoff"},
+		{"webhook network", func(c *Config) { c.Webhook.AllowedPrivateNetworks = []string{"localhost"} }, "webhook.allowed_private_networks"},
+		{"report limit", func(c *Config) { c.Report.Limit = 0 }, "report.limit"},
+		{"report window", func(c *Config) { c.Report.Window = -time.Hour }, "report.window"},
+		{"hide threshold", func(c *Config) { c.Report.HideThreshold = 0 }, "report.hide_threshold"},
+	} {
+		cfg := valid()
+		tt.change(&cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Validate() = %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// the example secret is fine for local development
+	cfg := valid()
+	cfg.Dev, cfg.Auth.Secret = true, devSecret
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("example secret in dev mode: %s", err)
+	}
+}
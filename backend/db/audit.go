@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// addAuditLogQuery is prepared by the repositories which record an admin action, so that it is committed with the change.
+const addAuditLogQuery = "INSERT INTO audit_logs (admin_id, action, target_type, target_id, amount, reason) VALUES (?, ?, ?, ?, ?, ?)"
+
+type AuditRepository interface {
+	GetAuditLogs(ctx context.Context) ([]domain.AuditLog, error)
+}
+
+type AuditDBRepository struct {
+	*DB
+
+	getAuditLogs *sql.Stmt
+}
+
+func NewAuditRepository(ctx context.Context, db *DB) (AuditRepository, error) {
+	p := db.preparer(ctx)
+	r := &AuditDBRepository{
+		DB:           db,
+		getAuditLogs: p.readAll("SELECT id, admin_id, action, target_type, target_id, amount, reason, created_at FROM audit_logs ORDER BY id desc"),
+	}
+	return r, p.err
+}
+
+// addAuditLog records the log with stmt, a statement of addAuditLogQuery.
+func addAuditLog(ctx context.Context, stmt *sql.Stmt, log domain.AuditLog) error {
+	if _, err := stmt.ExecContext(ctx, log.AdminID, log.Action, log.TargetType, log.TargetID, log.Amount, log.Reason); err != nil {
+		return translateError(err, "audit log")
+	}
+	return nil
+}
+
+func (r *AuditDBRepository) GetAuditLogs(ctx context.Context) ([]domain.AuditLog, error) {
+	rows, err := r.getAuditLogs.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []domain.AuditLog
+	for rows.Next() {
+		var log domain.AuditLog
+		if err := rows.Scan(&log.ID, &log.AdminID, &log.Action, &log.TargetType, &log.TargetID, &log.Amount, &log.Reason, &log.CreatedAt); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// BenchmarkItemRepository compares the throughput of concurrent item reads and writes on a SQLite file
+// opened with the driver defaults and with the tuned settings of config.DB.
+//
+//	go test ./db -run '^$' -bench ItemRepository
+func BenchmarkItemRepository(b *testing.B) {
+	for _, run := range []struct {
+		name string
+		open func(b *testing.B) *DB
+	}{
+		{"default", openDefaultDB},
+		{"tuned", func(b *testing.B) *DB { return newTestDB(b) }},
+	} {
+		for _, writePercent := range []int{0, 20} {
+			b.Run(fmt.Sprintf("%s/writes_%d_percent", run.name, writePercent), func(b *testing.B) {
+				benchItems(b, run.open(b), writePercent)
+			})
+		}
+	}
+}
+
+// openDefaultDB opens the DB the way PrepareDB did before the tuning: one unbounded pool without any pragma.
+func openDefaultDB(b *testing.B) *DB {
+	b.Helper()
+	ctx := context.Background()
+	cfg := testConfig(b)
+
+	sqlDB, err := sql.Open("sqlite3", cfg.DB.Path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { sqlDB.Close() })
+	schema, err := os.ReadFile(filepath.Join(cfg.DB.SQLDir, "01_schema.sql"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := sqlDB.ExecContext(ctx, string(schema)); err != nil {
+		b.Fatal(err)
+	}
+	if err := Migrate(ctx, sqlDB, cfg.DB.SQLDir); err != nil {
+		b.Fatal(err)
+	}
+	return &DB{Read: sqlDB, Write: sqlDB}
+}
+
+// benchItems runs GetItem and, for writePercent of the operations, AddItem from many goroutines.
+// Failed operations, e.g. SQLITE_BUSY with the default settings, are reported as errors/op rather than failing the benchmark.
+func benchItems(b *testing.B, db *DB, writePercent int) {
+	ctx := context.Background()
+	users, err := NewUserRepository(ctx, db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	items, err := NewItemRepository(ctx, db)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if _, err := db.Write.ExecContext(ctx, "INSERT INTO category (id, name) VALUES (1, 'bench')"); err != nil {
+		b.Fatal(err)
+	}
+	sellerID, err := users.AddUser(ctx, domain.User{Name: "seller", Password: "-"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	newItem := domain.Item{Name: "item", Price: 100, Description: "bench", CategoryID: 1, UserID: sellerID, Image: []byte{0}, Status: domain.ItemStatusOnSale}
+	first, err := items.AddItem(ctx, newItem)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var (
+		seed   atomic.Int64
+		errors atomic.Int64
+	)
+	// about as many goroutines as concurrent requests
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(seed.Add(1)))
+		for pb.Next() {
+			var err error
+			if rnd.Intn(100) < writePercent {
+				_, err = items.AddItem(ctx, newItem)
+			} else {
+				_, err = items.GetItem(ctx, first.ID)
+			}
+			if err != nil {
+				errors.Add(1)
+			}
+		}
+	})
+	b.ReportMetric(float64(errors.Load())/float64(b.N), "errors/op")
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type CommentRepository interface {
+	// AddComment stores the comment and returns it with its ID and timestamps.
+	AddComment(ctx context.Context, comment domain.Comment) (domain.Comment, error)
+	// GetCommentsByItemID returns up to limit comments on the item after the comment with the ID after, the oldest first.
+	GetCommentsByItemID(ctx context.Context, itemID, after int64, limit int) ([]domain.Comment, error)
+	// DeleteComment deletes a comment on the item. Comments on other items are not found.
+	DeleteComment(ctx context.Context, id, itemID int64) error
+}
+
+type CommentDBRepository struct {
+	*DB
+
+	addComment          *sql.Stmt
+	getCommentsByItemID *sql.Stmt
+	deleteComment       *sql.Stmt
+}
+
+func NewCommentRepository(ctx context.Context, db *DB) (CommentRepository, error) {
+	p := db.preparer(ctx)
+	r := &CommentDBRepository{
+		DB:         db,
+		addComment: p.write("INSERT INTO comments (item_id, user_id, body) VALUES (?, ?, ?) RETURNING id, created_at, updated_at"),
+		getCommentsByItemID: p.read(`SELECT comments.id, comments.item_id, comments.user_id, users.name, comments.body, comments.created_at, comments.updated_at
+			FROM comments JOIN users ON users.id = comments.user_id WHERE comments.item_id = ? AND comments.id > ? ORDER BY comments.id LIMIT ?`),
+		deleteComment: p.write("DELETE FROM comments WHERE id = ? AND item_id = ?"),
+	}
+	return r, p.err
+}
+
+func (r *CommentDBRepository) AddComment(ctx context.Context, comment domain.Comment) (domain.Comment, error) {
+	row := r.addComment.QueryRowContext(ctx, comment.ItemID, comment.UserID, comment.Body)
+	if err := row.Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt); err != nil {
+		return comment, translateError(err, "comment")
+	}
+	return comment, nil
+}
+
+func (r *CommentDBRepository) GetCommentsByItemID(ctx context.Context, itemID, after int64, limit int) ([]domain.Comment, error) {
+	rows, err := r.getCommentsByItemID.QueryContext(ctx, itemID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []domain.Comment
+	for rows.Next() {
+		var c domain.Comment
+		if err := rows.Scan(&c.ID, &c.ItemID, &c.UserID, &c.UserName, &c.Body, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *CommentDBRepository) DeleteComment(ctx context.Context, id, itemID int64) error {
+	res, err := r.deleteComment.ExecContext(ctx, id, itemID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "comment")
+}
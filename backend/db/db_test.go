@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
+)
+
+// testConfig is the default config with the DB in a temporary directory and the SQL of the repository.
+func testConfig(t testing.TB) *config.Config {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.DB.Path = filepath.Join(t.TempDir(), "mercari.sqlite3")
+	cfg.DB.SQLDir = filepath.Join("..", "sql")
+	return &cfg
+}
+
+// newTestDB prepares a DB with the schema and all the migrations, as on startup.
+func newTestDB(t testing.TB) *DB {
+	t.Helper()
+
+	db, err := PrepareDB(context.Background(), testConfig(t))
+	if err != nil {
+		t.Fatalf("failed to prepare DB: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
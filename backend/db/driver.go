@@ -3,36 +3,165 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
 	"github.com/pkg/errors"
 )
 
-func PrepareDB(ctx context.Context) (*sql.DB, error) {
-	path, err := os.Getwd()
+// DB holds two pools on the same SQLite file.
+// SQLite allows only one writer at a time, so Write has a single connection and writes wait in the pool
+// instead of failing with SQLITE_BUSY. Read has several read-only connections which WAL lets run alongside the writer.
+type DB struct {
+	Read  *sql.DB
+	Write *sql.DB
+
+	mu      sync.Mutex
+	queries []preparedQuery
+	// outboxWritten has a buffer of one, see OutboxWritten
+	outboxWritten chan struct{}
+}
+
+func (db *DB) PingContext(ctx context.Context) error {
+	if err := db.Write.PingContext(ctx); err != nil {
+		return err
+	}
+	return db.Read.PingContext(ctx)
+}
+
+func (db *DB) Close() error {
+	rerr := db.Read.Close()
+	if err := db.Write.Close(); err != nil {
+		return err
+	}
+	return rerr
+}
+
+func PrepareDB(ctx context.Context, cfg *config.Config) (*DB, error) {
+	write, err := Open(ctx, cfg.DB, false)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.ReadFile(filepath.Join(cfg.DB.SQLDir, "01_schema.sql"))
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get current path: %w")
+		write.Close()
+		return nil, errors.Wrap(err, "failed to open schema.sql %w")
+	}
+
+	if _, err = write.ExecContext(ctx, string(f)); err != nil {
+		write.Close()
+		return nil, errors.Wrap(err, "failed to exec query: %w")
+	}
+
+	if err = Migrate(ctx, write, cfg.DB.SQLDir); err != nil {
+		write.Close()
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", filepath.Join(path, "db", "mercari.sqlite3"))
+	// the read pool is opened after the schema exists since a read-only connection can't create the file
+	read, err := Open(ctx, cfg.DB, true)
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+
+	return &DB{Read: read, Write: write, outboxWritten: make(chan struct{}, 1)}, nil
+}
+
+// Open opens a pool on cfg.Path with the pragmas of cfg applied to every connection.
+func Open(ctx context.Context, cfg config.DB, readOnly bool) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", DSN(cfg, readOnly))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create DB: %w")
 	}
+	if readOnly {
+		db.SetMaxOpenConns(cfg.MaxReadConns)
+		db.SetMaxIdleConns(cfg.MaxReadConns)
+	} else {
+		db.SetMaxOpenConns(1)
+	}
+	// an idle connection keeps its prepared statements and page cache, so don't close them
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
 
 	if err = db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, errors.Wrap(err, "failed to ping DB: %w")
 	}
+	return db, nil
+}
 
-	f, err := os.ReadFile(filepath.Join(path, "sql", "01_schema.sql"))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to open schema.sql %w")
+// DSN builds the go-sqlite3 connection string. The driver runs the pragmas on each new connection.
+func DSN(cfg config.DB, readOnly bool) string {
+	q := url.Values{}
+	q.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+	q.Set("_synchronous", cfg.Synchronous)
+	if cfg.ForeignKeys {
+		q.Set("_foreign_keys", "1")
+	}
+	if readOnly {
+		q.Set("mode", "ro")
+	} else {
+		q.Set("_journal_mode", cfg.JournalMode)
+		// take the write lock at BEGIN so that a transaction doesn't fail when it upgrades from a read lock
+		q.Set("_txlock", "immediate")
 	}
+	return "file:" + cfg.Path + "?" + q.Encode()
+}
 
-	if _, err = db.ExecContext(ctx, string(f)); err != nil {
-		return nil, errors.Wrap(err, "failed to exec query: %w")
+// Checkpoint writes the WAL back into the DB file so that nothing is left in the WAL after the process exits.
+func Checkpoint(ctx context.Context, db *DB) error {
+	if _, err := db.Write.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return errors.Wrap(err, "failed to checkpoint WAL")
 	}
+	return nil
+}
 
-	return db, nil
+// preparer prepares statements one after another and keeps the first error,
+// so that constructors can list their statements without checking each of them.
+// The queries are recorded in the DB for CheckQueryPlans.
+type preparer struct {
+	ctx context.Context
+	db  *DB
+	err error
+}
+
+func (db *DB) preparer(ctx context.Context) *preparer {
+	return &preparer{ctx: ctx, db: db}
+}
+
+// read prepares a query on the read-only pool.
+func (p *preparer) read(query string) *sql.Stmt {
+	return p.prepare(p.db.Read, query, false)
+}
+
+// readAll prepares a query which reads a whole table by design, so that it is not reported as a full table scan.
+func (p *preparer) readAll(query string) *sql.Stmt {
+	return p.prepare(p.db.Read, query, true)
+}
+
+func (p *preparer) write(query string) *sql.Stmt {
+	return p.prepare(p.db.Write, query, false)
+}
+
+func (p *preparer) prepare(db *sql.DB, query string, fullScan bool) *sql.Stmt {
+	if p.err != nil {
+		return nil
+	}
+	stmt, err := db.PrepareContext(p.ctx, query)
+	if err != nil {
+		p.err = errors.Wrapf(err, "failed to prepare %q", query)
+		return nil
+	}
+
+	p.db.mu.Lock()
+	p.db.queries = append(p.db.queries, preparedQuery{query: query, fullScan: fullScan})
+	p.db.mu.Unlock()
+	return stmt
 }
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+// translateError converts driver level errors into domain errors so that handlers don't depend on database/sql.
+// A duplicated key is a ConflictError and a missing referenced row a NotFoundError.
+// Any other error, including the other constraint violations, is returned as is and ends up as an internal server error.
+func translateError(err error, resource string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NewNotFoundError(resource + " not found")
+	}
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return domain.NewConflictError(resource + " conflicts with an existing one")
+	case sqlite3.ErrConstraintForeignKey:
+		return domain.NewNotFoundError(resource + " refers to a missing resource")
+	}
+	return err
+}
+
+// requireAffected returns a NotFoundError when an UPDATE or DELETE didn't match any row.
+func requireAffected(res sql.Result, resource string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.NewNotFoundError(resource + " not found")
+	}
+	return nil
+}
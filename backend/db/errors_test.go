@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestTranslateError(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	if _, err := db.Write.ExecContext(ctx, "INSERT INTO users (id, name, email) VALUES (1, 'alice', 'alice@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+
+	isConflict := func(err error) bool { var e *domain.ConflictError; return errors.As(err, &e) }
+	isNotFound := func(err error) bool { var e *domain.NotFoundError; return errors.As(err, &e) }
+	isDriverError := func(err error) bool { return err != nil && !isConflict(err) && !isNotFound(err) }
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		want  func(error) bool
+	}{
+		{"unique", "INSERT INTO users (name, email) VALUES ('bob', 'alice@example.com')", isConflict},
+		{"primary key", "INSERT INTO users (id, name) VALUES (1, 'bob')", isConflict},
+		{"foreign key", "INSERT INTO likes (user_id, item_id) VALUES (1, 12345)", isNotFound},
+		{"not null", "INSERT INTO likes (user_id, item_id) VALUES (1, NULL)", isDriverError},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Write.ExecContext(ctx, tt.query)
+			if err == nil {
+				t.Fatal("no error from the query")
+			}
+			if got := translateError(err, "test"); !tt.want(got) {
+				t.Errorf("translateError(%v) = %#v", err, got)
+			}
+		})
+	}
+}
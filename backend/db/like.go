@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type LikeRepository interface {
+	// AddLike likes the item. Liking an item again is not an error.
+	AddLike(ctx context.Context, userID, itemID int64) error
+	// DeleteLike stops liking the item. Items which are not liked are ignored.
+	DeleteLike(ctx context.Context, userID, itemID int64) error
+	CountLikes(ctx context.Context, itemID int64) (int64, error)
+	IsLiked(ctx context.Context, userID, itemID int64) (bool, error)
+	// GetLikedItems returns the items the user likes, the most recently liked first.
+	GetLikedItems(ctx context.Context, userID int64) ([]domain.LikedItem, error)
+	// GetLikerIDs returns the users who like the item.
+	GetLikerIDs(ctx context.Context, itemID int64) ([]int64, error)
+}
+
+type LikeDBRepository struct {
+	*DB
+
+	addLike       *sql.Stmt
+	deleteLike    *sql.Stmt
+	countLikes    *sql.Stmt
+	isLiked       *sql.Stmt
+	getLikedItems *sql.Stmt
+	getLikerIDs   *sql.Stmt
+}
+
+func NewLikeRepository(ctx context.Context, db *DB) (LikeRepository, error) {
+	p := db.preparer(ctx)
+	r := &LikeDBRepository{
+		DB:         db,
+		addLike:    p.write("INSERT INTO likes (user_id, item_id) VALUES (?, ?) ON CONFLICT (user_id, item_id) DO NOTHING"),
+		deleteLike: p.write("DELETE FROM likes WHERE user_id = ? AND item_id = ?"),
+		countLikes: p.read("SELECT COUNT(*) FROM likes WHERE item_id = ?"),
+		isLiked:    p.read("SELECT EXISTS (SELECT 1 FROM likes WHERE user_id = ? AND item_id = ?)"),
+		getLikedItems: p.read(`SELECT items.id, items.name, items.price, items.description, items.category_id, items.seller_id,
+				items.status, items.created_at, items.updated_at, likes.created_at
+			FROM likes JOIN items ON items.id = likes.item_id WHERE likes.user_id = ? ORDER BY likes.id DESC`),
+		getLikerIDs: p.read("SELECT user_id FROM likes WHERE item_id = ? ORDER BY id"),
+	}
+	return r, p.err
+}
+
+func (r *LikeDBRepository) AddLike(ctx context.Context, userID, itemID int64) error {
+	_, err := r.addLike.ExecContext(ctx, userID, itemID)
+	return translateError(err, "like")
+}
+
+func (r *LikeDBRepository) DeleteLike(ctx context.Context, userID, itemID int64) error {
+	_, err := r.deleteLike.ExecContext(ctx, userID, itemID)
+	return err
+}
+
+func (r *LikeDBRepository) CountLikes(ctx context.Context, itemID int64) (int64, error) {
+	row := r.countLikes.QueryRowContext(ctx, itemID)
+
+	var n int64
+	return n, row.Scan(&n)
+}
+
+func (r *LikeDBRepository) IsLiked(ctx context.Context, userID, itemID int64) (bool, error) {
+	row := r.isLiked.QueryRowContext(ctx, userID, itemID)
+
+	var liked bool
+	return liked, row.Scan(&liked)
+}
+
+func (r *LikeDBRepository) GetLikedItems(ctx context.Context, userID int64) ([]domain.LikedItem, error) {
+	rows, err := r.getLikedItems.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.LikedItem
+	for rows.Next() {
+		var item domain.LikedItem
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID,
+			&item.Status, &item.CreatedAt, &item.UpdatedAt, &item.LikedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *LikeDBRepository) GetLikerIDs(ctx context.Context, itemID int64) ([]int64, error) {
+	rows, err := r.getLikerIDs.QueryContext(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
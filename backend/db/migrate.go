@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationDir is the directory of the migrations in the SQL dir.
+// Files are named <version>_<name>.sql and applied in the order of their version, each one only once.
+// 01_schema.sql is the base they apply to, so a change of the schema goes into a new migration instead of 01_schema.sql.
+const MigrationDir = "migrations"
+
+type migration struct {
+	version int
+	name    string
+	path    string
+}
+
+// Migrate applies the migrations in sqlDir which are not recorded in schema_migrations yet.
+//
+// Each migration runs in its own transaction with foreign keys disabled, so that a migration can rebuild a table
+// the way SQLite requires for adding constraints. Before the commit, PRAGMA foreign_key_check makes sure that
+// the data still satisfies every foreign key.
+func Migrate(ctx context.Context, db *sql.DB, sqlDir string) error {
+	migrations, err := loadMigrations(filepath.Join(sqlDir, MigrationDir))
+	if err != nil {
+		return err
+	}
+
+	// PRAGMA foreign_keys is per connection, so every statement below must run on the same one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    integer primary key,
+    name       text NOT NULL,
+    applied_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+)`); err != nil {
+		return errors.Wrap(err, "failed to create schema_migrations")
+	}
+
+	applied := map[int]bool{}
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var foreignKeys bool
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return err
+	}
+	if foreignKeys {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		log.Printf("Apply migration: %s\n", m.path)
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return errors.Wrapf(err, "failed to apply migration %s", m.path)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	f, err := os.ReadFile(m.path)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(f)); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var (
+			table, parent string
+			rowid         sql.NullInt64
+			fkid          int64
+		)
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s references a missing row of %s", rowid.Int64, table, parent)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func loadMigrations(dir string) ([]migration, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(paths))
+	seen := map[int]string{}
+	for _, path := range paths {
+		base := strings.TrimSuffix(filepath.Base(path), ".sql")
+		v, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>.sql", path)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, path)
+		}
+		seen[version] = path
+		migrations = append(migrations, migration{version: version, name: name, path: path})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
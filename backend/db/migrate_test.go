@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// baselineData is a DB written by the version before the migrations: only 01_schema.sql and no schema_migrations.
+const baselineData = `
+INSERT INTO category (id, name) VALUES (1, 'fashion'), (2, 'books');
+INSERT INTO status (id, name) VALUES (1, 'initial'), (2, 'on_sale'), (3, 'sold_out');
+INSERT INTO users (id, name, password, balance) VALUES (1, 'alice', 'x', 1000), (2, 'bob', 'y', 0);
+INSERT INTO items (id, name, price, description, category_id, seller_id, image, status)
+VALUES (1, 'shirt', 500, 'a shirt', 1, 1, x'89504e47', 2),
+       (2, 'book', 300, 'a book', 2, 2, x'89504e47', 3);
+`
+
+func TestMigrateBaselineDB(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+
+	schema, err := os.ReadFile(filepath.Join(cfg.DB.SQLDir, "01_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := Open(ctx, cfg.DB, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := baseline.ExecContext(ctx, string(schema)+baselineData); err != nil {
+		t.Fatalf("failed to write the baseline DB: %s", err)
+	}
+	baseline.Close()
+
+	// startup runs the schema and the migrations on the existing file
+	db, err := PrepareDB(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to upgrade the baseline DB: %s", err)
+	}
+	defer db.Close()
+
+	migrations, err := loadMigrations(filepath.Join(cfg.DB.SQLDir, MigrationDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied int
+	if err := db.Read.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", applied, len(migrations))
+	}
+
+	// the statements of every repository refer to the columns and tables added by the migrations
+	for name, newRepo := range map[string]func(context.Context, *DB) error{
+		"audit":          func(ctx context.Context, db *DB) error { _, err := NewAuditRepository(ctx, db); return err },
+		"comment":        func(ctx context.Context, db *DB) error { _, err := NewCommentRepository(ctx, db); return err },
+		"item":           func(ctx context.Context, db *DB) error { _, err := NewItemRepository(ctx, db); return err },
+		"like":           func(ctx context.Context, db *DB) error { _, err := NewLikeRepository(ctx, db); return err },
+		"notification":   func(ctx context.Context, db *DB) error { _, err := NewNotificationRepository(ctx, db); return err },
+		"outbox":         func(ctx context.Context, db *DB) error { _, err := NewOutboxRepository(ctx, db); return err },
+		"password reset": func(ctx context.Context, db *DB) error { _, err := NewPasswordResetRepository(ctx, db); return err },
+		"report":         func(ctx context.Context, db *DB) error { _, err := NewReportRepository(ctx, db); return err },
+		"saved search":   func(ctx context.Context, db *DB) error { _, err := NewSavedSearchRepository(ctx, db); return err },
+		"search":         func(ctx context.Context, db *DB) error { _, err := NewSearchRepository(ctx, db); return err },
+		"user":           func(ctx context.Context, db *DB) error { _, err := NewUserRepository(ctx, db); return err },
+		"webhook":        func(ctx context.Context, db *DB) error { _, err := NewWebhookRepository(ctx, db); return err },
+	} {
+		if err := newRepo(ctx, db); err != nil {
+			t.Errorf("failed to create the %s repository: %s", name, err)
+		}
+	}
+
+	users, err := NewUserRepository(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := users.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Name != "alice" || alice.Balance != 1000 || alice.Role != domain.RoleUser || alice.Suspended || alice.Email != "" {
+		t.Errorf("alice after the upgrade = %+v", alice)
+	}
+
+	// new rows get the defaults of the rebuilt table
+	id, err := users.AddUser(ctx, domain.User{Name: "carol", Password: "z", Email: "carol@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var createdAt string
+	if err := db.Read.QueryRowContext(ctx, "SELECT created_at FROM users WHERE id = ?", id).Scan(&createdAt); err != nil {
+		t.Fatal(err)
+	}
+	if createdAt == "" {
+		t.Error("created_at of a new user is empty")
+	}
+	if _, err := users.AddUser(ctx, domain.User{Name: "dave", Password: "w", Email: "carol@example.com"}); err == nil {
+		t.Error("a second user with the same email was added")
+	}
+
+	var items int
+	if err := db.Read.QueryRowContext(ctx, "SELECT COUNT(*) FROM items").Scan(&items); err != nil {
+		t.Fatal(err)
+	}
+	if items != 2 {
+		t.Errorf("%d items after the upgrade, want 2", items)
+	}
+
+	// the next startup has nothing to apply
+	db.Close()
+	db, err = PrepareDB(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to start on the upgraded DB: %s", err)
+	}
+	db.Close()
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(filepath.Join("..", "sql", MigrationDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.path, m.version, i+1)
+		}
+	}
+}
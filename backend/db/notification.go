@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type NotificationRepository interface {
+	// AddNotifications stores the notifications at once and returns them with their IDs and creation times.
+	AddNotifications(ctx context.Context, notifications []domain.Notification) ([]domain.Notification, error)
+	// GetNotificationsByUserID returns up to limit notifications of the user, the newest first.
+	GetNotificationsByUserID(ctx context.Context, userID int64, limit int) ([]domain.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID int64) (int64, error)
+	// MarkNotificationsRead marks the notifications of the user with the IDs as read, or all of them when ids is empty.
+	// IDs of notifications of other users are ignored.
+	MarkNotificationsRead(ctx context.Context, userID int64, ids []int64, readAt time.Time) error
+	// GetNotificationPreferences returns the preferences the user has changed. The other kinds have the defaults.
+	GetNotificationPreferences(ctx context.Context, userID int64) ([]domain.NotificationPreference, error)
+	SetNotificationPreferences(ctx context.Context, prefs []domain.NotificationPreference) error
+}
+
+type NotificationDBRepository struct {
+	*DB
+
+	addNotification            *sql.Stmt
+	getNotificationsByUserID   *sql.Stmt
+	countUnreadNotifications   *sql.Stmt
+	markNotificationsRead      *sql.Stmt
+	getNotificationPreferences *sql.Stmt
+	setNotificationPreference  *sql.Stmt
+}
+
+func NewNotificationRepository(ctx context.Context, db *DB) (NotificationRepository, error) {
+	p := db.preparer(ctx)
+	r := &NotificationDBRepository{
+		DB:              db,
+		addNotification: p.write("INSERT INTO notifications (user_id, kind, item_id, message) VALUES (?, ?, NULLIF(?, 0), ?) RETURNING id, created_at"),
+		getNotificationsByUserID: p.read(`SELECT id, user_id, kind, COALESCE(item_id, 0), message, created_at, COALESCE(read_at, '')
+			FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?`),
+		countUnreadNotifications: p.read("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL"),
+		markNotificationsRead: p.write(`UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL
+			AND (json_array_length(?) = 0 OR id IN (SELECT value FROM json_each(?)))`),
+		getNotificationPreferences: p.read("SELECT user_id, kind, inbox, email FROM notification_preferences WHERE user_id = ?"),
+		setNotificationPreference: p.write(`INSERT INTO notification_preferences (user_id, kind, inbox, email) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, kind) DO UPDATE SET inbox = excluded.inbox, email = excluded.email`),
+	}
+	return r, p.err
+}
+
+func (r *NotificationDBRepository) AddNotifications(ctx context.Context, notifications []domain.Notification) ([]domain.Notification, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := tx.StmtContext(ctx, r.addNotification)
+	added := make([]domain.Notification, len(notifications))
+	for i, n := range notifications {
+		row := stmt.QueryRowContext(ctx, n.UserID, n.Kind, n.ItemID, n.Message)
+		if err := row.Scan(&n.ID, &n.CreatedAt); err != nil {
+			return nil, translateError(err, "notification")
+		}
+		added[i] = n
+	}
+	return added, tx.Commit()
+}
+
+func (r *NotificationDBRepository) GetNotificationsByUserID(ctx context.Context, userID int64, limit int) ([]domain.Notification, error) {
+	rows, err := r.getNotificationsByUserID.QueryContext(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []domain.Notification
+	for rows.Next() {
+		var n domain.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.ItemID, &n.Message, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *NotificationDBRepository) CountUnreadNotifications(ctx context.Context, userID int64) (int64, error) {
+	row := r.countUnreadNotifications.QueryRowContext(ctx, userID)
+
+	var n int64
+	return n, row.Scan(&n)
+}
+
+func (r *NotificationDBRepository) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64, readAt time.Time) error {
+	if ids == nil {
+		// json_array_length(null) is null, not 0
+		ids = []int64{}
+	}
+	idList, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	_, err = r.markNotificationsRead.ExecContext(ctx, readAt.Format(sqliteTimeLayout), userID, idList, idList)
+	return err
+}
+
+func (r *NotificationDBRepository) GetNotificationPreferences(ctx context.Context, userID int64) ([]domain.NotificationPreference, error) {
+	rows, err := r.getNotificationPreferences.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefs []domain.NotificationPreference
+	for rows.Next() {
+		var pref domain.NotificationPreference
+		if err := rows.Scan(&pref.UserID, &pref.Kind, &pref.Inbox, &pref.Email); err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, pref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (r *NotificationDBRepository) SetNotificationPreferences(ctx context.Context, prefs []domain.NotificationPreference) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := tx.StmtContext(ctx, r.setNotificationPreference)
+	for _, pref := range prefs {
+		if _, err := stmt.ExecContext(ctx, pref.UserID, pref.Kind, pref.Inbox, pref.Email); err != nil {
+			return translateError(err, "notification preference")
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// addEventQuery is prepared by the repositories which raise events.
+const addEventQuery = "INSERT INTO outbox (type, payload) VALUES (?, ?)"
+
+// addEvents writes the events to the outbox with stmt, a statement of addEventQuery in the transaction of the change,
+// so that they are stored if and only if the change is committed. The caller signals the outbox after the commit.
+func addEvents(ctx context.Context, stmt *sql.Stmt, events ...domain.Event) error {
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, e.EventType(), payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutboxWritten receives a value after events were committed to the outbox. Several commits may be signaled once.
+func (db *DB) OutboxWritten() <-chan struct{} {
+	return db.outboxWritten
+}
+
+func (db *DB) signalOutbox() {
+	select {
+	case db.outboxWritten <- struct{}{}:
+	default:
+	}
+}
+
+type OutboxRepository interface {
+	// GetPendingEvents returns up to limit events which are due at now, the oldest first.
+	GetPendingEvents(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error)
+	MarkEventDispatched(ctx context.Context, id int64, at time.Time) error
+	// RetryEvent records a failed attempt and the subscribers which handled the event, and dispatches it again at next.
+	RetryEvent(ctx context.Context, id int64, done []string, next time.Time, lastError string) error
+	// FailEvent records the last failed attempt and gives up the event.
+	FailEvent(ctx context.Context, id int64, done []string, at time.Time, lastError string) error
+	// DeleteDispatchedEvents deletes the events dispatched before the time and returns how many were deleted.
+	DeleteDispatchedEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+type OutboxDBRepository struct {
+	*DB
+
+	getPendingEvents       *sql.Stmt
+	markEventDispatched    *sql.Stmt
+	retryEvent             *sql.Stmt
+	failEvent              *sql.Stmt
+	deleteDispatchedEvents *sql.Stmt
+}
+
+func NewOutboxRepository(ctx context.Context, db *DB) (OutboxRepository, error) {
+	p := db.preparer(ctx)
+	r := &OutboxDBRepository{
+		DB: db,
+		getPendingEvents: p.read(`SELECT id, type, payload, attempts, done, created_at FROM outbox
+			WHERE dispatched_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ? ORDER BY id LIMIT ?`),
+		markEventDispatched:    p.write("UPDATE outbox SET dispatched_at = ? WHERE id = ?"),
+		retryEvent:             p.write("UPDATE outbox SET attempts = attempts + 1, done = ?, next_attempt_at = ?, last_error = ? WHERE id = ?"),
+		failEvent:              p.write("UPDATE outbox SET attempts = attempts + 1, done = ?, failed_at = ?, last_error = ? WHERE id = ?"),
+		deleteDispatchedEvents: p.write("DELETE FROM outbox WHERE dispatched_at IS NOT NULL AND dispatched_at < ?"),
+	}
+	return r, p.err
+}
+
+func (r *OutboxDBRepository) GetPendingEvents(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error) {
+	rows, err := r.getPendingEvents.QueryContext(ctx, now.Format(sqliteTimeLayout), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.OutboxEvent
+	for rows.Next() {
+		var (
+			e    domain.OutboxEvent
+			done []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &e.Payload, &e.Attempts, &done, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(done, &e.Done); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *OutboxDBRepository) MarkEventDispatched(ctx context.Context, id int64, at time.Time) error {
+	res, err := r.markEventDispatched.ExecContext(ctx, at.Format(sqliteTimeLayout), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "event")
+}
+
+func (r *OutboxDBRepository) RetryEvent(ctx context.Context, id int64, done []string, next time.Time, lastError string) error {
+	return r.recordFailure(ctx, r.retryEvent, id, done, next, lastError)
+}
+
+func (r *OutboxDBRepository) FailEvent(ctx context.Context, id int64, done []string, at time.Time, lastError string) error {
+	return r.recordFailure(ctx, r.failEvent, id, done, at, lastError)
+}
+
+func (r *OutboxDBRepository) recordFailure(ctx context.Context, stmt *sql.Stmt, id int64, done []string, at time.Time, lastError string) error {
+	if done == nil {
+		done = []string{}
+	}
+	doneList, err := json.Marshal(done)
+	if err != nil {
+		return err
+	}
+	res, err := stmt.ExecContext(ctx, doneList, at.Format(sqliteTimeLayout), lastError, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "event")
+}
+
+func (r *OutboxDBRepository) DeleteDispatchedEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.deleteDispatchedEvents.ExecContext(ctx, before.Format(sqliteTimeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
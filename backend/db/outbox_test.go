@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestOutboxRetry(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo, err := NewOutboxRepository(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Write.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := tx.PrepareContext(ctx, addEventQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addEvents(ctx, stmt, domain.BalanceToppedUp{UserID: 1, Amount: 100, Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	pending, err := repo.GetPendingEvents(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Type != domain.EventTypeBalanceToppedUp || pending[0].Attempts != 0 || len(pending[0].Done) != 0 {
+		t.Fatalf("pending events = %+v", pending)
+	}
+	id := pending[0].ID
+
+	// a retry is only due at its time and keeps the subscribers which are done
+	if err := repo.RetryEvent(ctx, id, []string{"realtime"}, now.Add(time.Minute), "notifications: failed"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := repo.GetPendingEvents(ctx, now, 10); len(pending) != 0 {
+		t.Fatalf("pending events before the retry = %+v", pending)
+	}
+	pending, err = repo.GetPendingEvents(ctx, now.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Attempts != 1 || !reflect.DeepEqual(pending[0].Done, []string{"realtime"}) {
+		t.Fatalf("pending events at the retry = %+v", pending)
+	}
+
+	if err := repo.MarkEventDispatched(ctx, id, now); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := repo.GetPendingEvents(ctx, now.Add(time.Hour), 10); len(pending) != 0 {
+		t.Errorf("pending events after the dispatch = %+v", pending)
+	}
+	if n, err := repo.DeleteDispatchedEvents(ctx, now.Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("deleted %d dispatched events, err = %v", n, err)
+	}
+	if err := repo.MarkEventDispatched(ctx, id, now); err == nil {
+		t.Error("a deleted event was marked as dispatched")
+	}
+}
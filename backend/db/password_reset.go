@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type PasswordResetRepository interface {
+	// AddPasswordReset stores a new reset token of the user and revokes the expired ones, unless the user has a live token,
+	// unused and not expired at now. It reports whether the token was stored.
+	AddPasswordReset(ctx context.Context, userID int64, tokenHash string, now, expiresAt time.Time) (bool, error)
+	// ConsumePasswordReset marks the token as used and returns its user.
+	// The token can be consumed only once and only before it expires.
+	ConsumePasswordReset(ctx context.Context, tokenHash string, now time.Time) (int64, error)
+}
+
+type PasswordResetDBRepository struct {
+	*DB
+
+	hasLivePasswordReset *sql.Stmt
+	revokePasswordResets *sql.Stmt
+	addPasswordReset     *sql.Stmt
+	consumePasswordReset *sql.Stmt
+}
+
+func NewPasswordResetRepository(ctx context.Context, db *DB) (PasswordResetRepository, error) {
+	p := db.preparer(ctx)
+	r := &PasswordResetDBRepository{
+		DB:                   db,
+		hasLivePasswordReset: p.write("SELECT EXISTS (SELECT 1 FROM password_resets WHERE user_id = ? AND used_at IS NULL AND expires_at > ?)"),
+		revokePasswordResets: p.write("DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL"),
+		addPasswordReset:     p.write("INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)"),
+		consumePasswordReset: p.write("UPDATE password_resets SET used_at = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ? RETURNING user_id"),
+	}
+	return r, p.err
+}
+
+func (r *PasswordResetDBRepository) AddPasswordReset(ctx context.Context, userID int64, tokenHash string, now, expiresAt time.Time) (bool, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// one token of the user is valid at a time, also when requests race
+	var live bool
+	if err := tx.StmtContext(ctx, r.hasLivePasswordReset).QueryRowContext(ctx, userID, now.Format(sqliteTimeLayout)).Scan(&live); err != nil {
+		return false, err
+	}
+	if live {
+		return false, nil
+	}
+	if _, err := tx.StmtContext(ctx, r.revokePasswordResets).ExecContext(ctx, userID); err != nil {
+		return false, err
+	}
+	if _, err := tx.StmtContext(ctx, r.addPasswordReset).ExecContext(ctx, userID, tokenHash, expiresAt.Format(sqliteTimeLayout)); err != nil {
+		return false, translateError(err, "password reset")
+	}
+	return true, tx.Commit()
+}
+
+func (r *PasswordResetDBRepository) ConsumePasswordReset(ctx context.Context, tokenHash string, now time.Time) (int64, error) {
+	row := r.consumePasswordReset.QueryRowContext(ctx, now.Format(sqliteTimeLayout), tokenHash, now.Format(sqliteTimeLayout))
+
+	var userID int64
+	if err := row.Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, domain.NewPreconditionFailedError("reset token is invalid or expired")
+		}
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type preparedQuery struct {
+	query string
+	// fullScan is set when the query reads the whole table on purpose.
+	fullScan bool
+}
+
+// CheckQueryPlans runs EXPLAIN QUERY PLAN on every query prepared by the repositories
+// and returns a warning for each one which scans a whole table, which usually means a missing index.
+func (db *DB) CheckQueryPlans(ctx context.Context) ([]string, error) {
+	db.mu.Lock()
+	queries := append([]preparedQuery(nil), db.queries...)
+	db.mu.Unlock()
+
+	var warnings []string
+	seen := map[string]bool{}
+	for _, q := range queries {
+		if q.fullScan || seen[q.query] {
+			continue
+		}
+		seen[q.query] = true
+
+		scans, err := db.tableScans(ctx, q.query)
+		if err != nil {
+			return nil, err
+		}
+		for _, scan := range scans {
+			warnings = append(warnings, fmt.Sprintf("full table scan (%s) in %q", scan, strings.Join(strings.Fields(q.query), " ")))
+		}
+	}
+	return warnings, nil
+}
+
+// cteName matches the names defined in a WITH clause, e.g. "descendants(id) AS (".
+var cteName = regexp.MustCompile(`(?i)(\w+)(?:\([^)]*\))?\s+AS\s*\(`)
+
+// tableScans returns the steps of the plan of query which read every row of a table.
+// A SCAN step using an index only walks the index in order, and a scan of a common table expression
+// or a table-valued function such as json_each only reads the rows it produced, so none of them is one.
+func (db *DB) tableScans(ctx context.Context, query string) ([]string, error) {
+	ctes := map[string]bool{}
+	for _, m := range cteName.FindAllStringSubmatch(query, -1) {
+		ctes[m[1]] = true
+	}
+
+	// the plan doesn't depend on the values, so every parameter is bound to NULL
+	args := make([]any, strings.Count(query, "?"))
+	rows, err := db.Read.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to explain %q", query)
+	}
+	defer rows.Close()
+
+	var scans []string
+	for rows.Next() {
+		var (
+			id, parent, notUsed int
+			detail              string
+		)
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(detail)
+		if len(fields) < 2 || fields[0] != "SCAN" || strings.Contains(detail, " USING ") || strings.Contains(detail, " VIRTUAL TABLE ") || ctes[fields[1]] || detail == "SCAN CONSTANT ROW" {
+			continue
+		}
+		scans = append(scans, detail)
+	}
+	return scans, rows.Err()
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// sqliteTimeLayout is the layout of DATETIME('now', 'localtime').
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+const (
+	addReportQuery = "INSERT INTO reports (item_id, reporter_id, reason, comment) VALUES (?, ?, ?, ?)"
+	// countOpenReportsQuery counts the users who reported the item since it was last reviewed.
+	countOpenReportsQuery            = "SELECT COUNT(DISTINCT reporter_id) FROM reports WHERE item_id = ? AND resolved_at IS NULL"
+	countReportsByReporterSinceQuery = "SELECT COUNT(*) FROM reports WHERE reporter_id = ? AND created_at >= ?"
+)
+
+// ReportRepository reads the reports. They are added by ItemRepository.Report, which checks the limits in the same transaction.
+type ReportRepository interface {
+	// GetFlaggedItems returns the items under moderation, the hidden ones first, each the last updated first.
+	GetFlaggedItems(ctx context.Context) ([]domain.FlaggedItem, error)
+}
+
+type ReportDBRepository struct {
+	*DB
+
+	getFlaggedItems *sql.Stmt
+}
+
+func NewReportRepository(ctx context.Context, db *DB) (ReportRepository, error) {
+	p := db.preparer(ctx)
+	r := &ReportDBRepository{
+		DB: db,
+		getFlaggedItems: p.read(`SELECT items.id, items.name, items.seller_id, items.status, COUNT(DISTINCT reports.reporter_id) FROM items
+			LEFT JOIN reports ON reports.item_id = items.id AND reports.resolved_at IS NULL
+			WHERE items.status IN (?, ?)
+			GROUP BY items.id
+			ORDER BY items.status = ? desc, items.updated_at desc`),
+	}
+	return r, p.err
+}
+
+func (r *ReportDBRepository) GetFlaggedItems(ctx context.Context) ([]domain.FlaggedItem, error) {
+	rows, err := r.getFlaggedItems.QueryContext(ctx, domain.ItemStatusHidden, domain.ItemStatusModerated, domain.ItemStatusHidden)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.FlaggedItem
+	for rows.Next() {
+		var item domain.FlaggedItem
+		if err := rows.Scan(&item.ID, &item.Name, &item.UserID, &item.Status, &item.ReportCount); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
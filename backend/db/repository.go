@@ -3,96 +3,437 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
 )
 
 type UserRepository interface {
+	// AddUser raises UserRegistered.
 	AddUser(ctx context.Context, user domain.User) (int64, error)
 	GetUser(ctx context.Context, id int64) (domain.User, error)
-	UpdateBalance(ctx context.Context, id int64, balance int64) error
+	// TopUp adds amount to the balance of the user, raises BalanceToppedUp and returns the new balance.
+	// A balance which would become negative is refused.
+	TopUp(ctx context.Context, id int64, amount int64) (int64, error)
+	// AdjustBalance is TopUp by an admin. It records log with the amount in the audit trail and raises BalanceAdjusted instead.
+	AdjustBalance(ctx context.Context, id int64, amount int64, log domain.AuditLog) (int64, error)
+	// SetSuspended suspends or unsuspends the user and records log in the audit trail.
+	SetSuspended(ctx context.Context, id int64, suspended bool, log domain.AuditLog) error
+	GetSuspendedUsers(ctx context.Context) ([]domain.User, error)
+	GetUserProfile(ctx context.Context, id int64) (domain.UserProfile, error)
+	// GetUserAvatar returns the avatar of the user and its MIME type.
+	GetUserAvatar(ctx context.Context, id int64) ([]byte, string, error)
+	// UpdateProfile updates name and bio of the user. Email and avatar are kept as is when they are empty.
+	UpdateProfile(ctx context.Context, user domain.User) error
+	GetUserByEmail(ctx context.Context, email string) (domain.User, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
 }
 
 type UserDBRepository struct {
-	*sql.DB
+	*DB
+
+	addUser           *sql.Stmt
+	getUser           *sql.Stmt
+	getUserByEmail    *sql.Stmt
+	updatePassword    *sql.Stmt
+	setSuspended      *sql.Stmt
+	getUserProfile    *sql.Stmt
+	getUserAvatar     *sql.Stmt
+	updateProfile     *sql.Stmt
+	getSuspendedUsers *sql.Stmt
+	topUp             *sql.Stmt
+	addAuditLog       *sql.Stmt
+	addEvent          *sql.Stmt
 }
 
-func NewUserRepository(db *sql.DB) UserRepository {
-	return &UserDBRepository{DB: db}
+// NewUserRepository prepares the statements of the repository once. They are reused by every request.
+func NewUserRepository(ctx context.Context, db *DB) (UserRepository, error) {
+	p := db.preparer(ctx)
+	r := &UserDBRepository{
+		DB:             db,
+		addUser:        p.write("INSERT INTO users (name, password, email) VALUES (?, ?, NULLIF(?, ''))"),
+		getUser:        p.read("SELECT id, name, password, balance, role, suspended, COALESCE(email, '') FROM users WHERE id = ?"),
+		getUserByEmail: p.read("SELECT id, name, password, balance, role, suspended, email FROM users WHERE email = ?"),
+		updatePassword: p.write("UPDATE users SET password = ? WHERE id = ?"),
+		setSuspended:   p.write("UPDATE users SET suspended = ? WHERE id = ?"),
+		getUserProfile: p.read(`SELECT id, name, bio, avatar IS NOT NULL, created_at,
+			(SELECT COUNT(*) FROM items WHERE seller_id = users.id AND status = ?),
+			(SELECT COUNT(*) FROM items WHERE seller_id = users.id AND status = ?)
+			FROM users WHERE id = ?`),
+		getUserAvatar: p.read("SELECT avatar, COALESCE(avatar_type, '') FROM users WHERE id = ?"),
+		updateProfile: p.write(`UPDATE users SET name = ?, bio = ?, email = COALESCE(NULLIF(?, ''), email),
+			avatar = COALESCE(?, avatar), avatar_type = COALESCE(NULLIF(?, ''), avatar_type) WHERE id = ?`),
+		getSuspendedUsers: p.read("SELECT id, name, password, balance, role, suspended FROM users WHERE suspended = 1"),
+		topUp:             p.write("UPDATE users SET balance = balance + ? WHERE id = ? RETURNING balance"),
+		addAuditLog:       p.write(addAuditLogQuery),
+		addEvent:          p.write(addEventQuery),
+	}
+	return r, p.err
 }
 
 func (r *UserDBRepository) AddUser(ctx context.Context, user domain.User) (int64, error) {
-	if _, err := r.ExecContext(ctx, "INSERT INTO users (name, password) VALUES (?, ?)", user.Name, user.Password); err != nil {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
 		return 0, err
 	}
-	// TODO: if other insert query is executed at the same time, it might return wrong id
-	// http.StatusConflict(409) 既に同じIDがあった場合
-	row := r.QueryRowContext(ctx, "SELECT id FROM users WHERE rowid = LAST_INSERT_ROWID()")
+	defer tx.Rollback()
 
-	var id int64
-	return id, row.Scan(&id)
+	res, err := tx.StmtContext(ctx, r.addUser).ExecContext(ctx, user.Name, user.Password, user.Email)
+	if err != nil {
+		return 0, translateError(err, "user")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := addEvents(ctx, tx.StmtContext(ctx, r.addEvent), domain.UserRegistered{UserID: id, Name: user.Name}); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.signalOutbox()
+	return id, nil
 }
 
 func (r *UserDBRepository) GetUser(ctx context.Context, id int64) (domain.User, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM users WHERE id = ?", id)
+	row := r.getUser.QueryRowContext(ctx, id)
 
 	var user domain.User
-	return user, row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance)
+	err := row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance, &user.Role, &user.Suspended, &user.Email)
+	return user, translateError(err, "user")
 }
 
-func (r *UserDBRepository) UpdateBalance(ctx context.Context, id int64, balance int64) error {
-	if _, err := r.ExecContext(ctx, "UPDATE users SET balance = ? WHERE id = ?", balance, id); err != nil {
+func (r *UserDBRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	row := r.getUserByEmail.QueryRowContext(ctx, email)
+
+	var user domain.User
+	err := row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance, &user.Role, &user.Suspended, &user.Email)
+	return user, translateError(err, "user")
+}
+
+func (r *UserDBRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	res, err := r.updatePassword.ExecContext(ctx, password, id)
+	if err != nil {
 		return err
 	}
-	return nil
+	return requireAffected(res, "user")
+}
+
+func (r *UserDBRepository) TopUp(ctx context.Context, id int64, amount int64) (int64, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	balance, err := r.addBalance(ctx, tx, id, amount)
+	if err != nil {
+		return 0, err
+	}
+	if err := addEvents(ctx, tx.StmtContext(ctx, r.addEvent), domain.BalanceToppedUp{UserID: id, Amount: amount, Balance: balance}); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.signalOutbox()
+	return balance, nil
+}
+
+func (r *UserDBRepository) AdjustBalance(ctx context.Context, id int64, amount int64, log domain.AuditLog) (int64, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	balance, err := r.addBalance(ctx, tx, id, amount)
+	if err != nil {
+		return 0, err
+	}
+	log.Amount = amount
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return 0, err
+	}
+	if err := addEvents(ctx, tx.StmtContext(ctx, r.addEvent), domain.BalanceAdjusted{UserID: id, Amount: amount, Balance: balance}); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.signalOutbox()
+	return balance, nil
+}
+
+// addBalance adds amount to the balance of the user in tx and returns the new balance, refusing a negative one.
+func (r *UserDBRepository) addBalance(ctx context.Context, tx *sql.Tx, id int64, amount int64) (int64, error) {
+	var balance int64
+	if err := tx.StmtContext(ctx, r.topUp).QueryRowContext(ctx, amount, id).Scan(&balance); err != nil {
+		return 0, translateError(err, "user")
+	}
+	if balance < 0 {
+		return 0, domain.NewPreconditionFailedError("balance cannot be negative")
+	}
+	return balance, nil
+}
+
+func (r *UserDBRepository) SetSuspended(ctx context.Context, id int64, suspended bool, log domain.AuditLog) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(ctx, r.setSuspended).ExecContext(ctx, suspended, id)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res, "user"); err != nil {
+		return err
+	}
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *UserDBRepository) GetUserProfile(ctx context.Context, id int64) (domain.UserProfile, error) {
+	row := r.getUserProfile.QueryRowContext(ctx, domain.ItemStatusOnSale, domain.ItemStatusSoldOut, id)
+
+	var p domain.UserProfile
+	err := row.Scan(&p.ID, &p.Name, &p.Bio, &p.HasAvatar, &p.CreatedAt, &p.ListingCount, &p.SoldCount)
+	return p, translateError(err, "user")
+}
+
+func (r *UserDBRepository) GetUserAvatar(ctx context.Context, id int64) ([]byte, string, error) {
+	row := r.getUserAvatar.QueryRowContext(ctx, id)
+
+	var (
+		avatar      []byte
+		contentType string
+	)
+	if err := row.Scan(&avatar, &contentType); err != nil {
+		return nil, "", translateError(err, "user")
+	}
+	if avatar == nil {
+		return nil, "", domain.NewNotFoundError("avatar not found")
+	}
+	return avatar, contentType, nil
+}
+
+func (r *UserDBRepository) UpdateProfile(ctx context.Context, user domain.User) error {
+	res, err := r.updateProfile.ExecContext(ctx, user.Name, user.Bio, user.Email, user.Avatar, user.AvatarType, user.ID)
+	if err != nil {
+		return translateError(err, "email")
+	}
+	return requireAffected(res, "user")
+}
+
+func (r *UserDBRepository) GetSuspendedUsers(ctx context.Context) ([]domain.User, error) {
+	rows, err := r.getSuspendedUsers.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Password, &user.Balance, &user.Role, &user.Suspended); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
 }
 
 type ItemRepository interface {
 	AddItem(ctx context.Context, item domain.Item) (domain.Item, error)
-	GetItem(ctx context.Context, id int32) (domain.Item, error)
-	GetItemImage(ctx context.Context, id int32) ([]byte, error)
+	GetItem(ctx context.Context, id int64) (domain.Item, error)
+	GetItemImage(ctx context.Context, id int64) ([]byte, error)
 	GetOnSaleItems(ctx context.Context) ([]domain.Item, error)
+	// GetItems returns the items matching the filter, the last updated first.
+	GetItems(ctx context.Context, filter domain.ItemFilter) ([]domain.Item, error)
 	GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error)
+	GetItemsByStatus(ctx context.Context, status domain.ItemStatus) ([]domain.Item, error)
+	// GetOnSaleItemsInCategory returns the items on sale in the category and its descendants.
+	GetOnSaleItemsInCategory(ctx context.Context, categoryID int64) ([]domain.Item, error)
 	GetCategory(ctx context.Context, id int64) (domain.Category, error)
 	GetCategories(ctx context.Context) ([]domain.Category, error)
-	UpdateItemStatus(ctx context.Context, id int32, status domain.ItemStatus) error
+	UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error
+	// Moderate hides or takes down an item, status being ItemStatusHidden or ItemStatusModerated, and records log in the audit trail.
+	// The status it had before is kept for Restore, also when an item under moderation is moderated again.
+	Moderate(ctx context.Context, id int64, status domain.ItemStatus, log domain.AuditLog) error
+	// Restore gives an item under moderation back the status it had before, records log in the audit trail and returns the status.
+	// The reports of the item are resolved, so that they don't count towards hiding it again.
+	Restore(ctx context.Context, id int64, log domain.AuditLog) (domain.ItemStatus, error)
+	// Report stores the report unless the reporter reached the limit, and hides the item on sale once enough distinct users
+	// reported it since it was last reviewed. It returns whether the item was hidden.
+	Report(ctx context.Context, report domain.Report, limits domain.ReportLimits) (bool, error)
+	// ListItem puts a draft on sale and raises ItemListed.
+	ListItem(ctx context.Context, id int64) error
+	// Purchase marks an item on sale as sold out, moves its price from the buyer to the seller and raises ItemSold,
+	// all or nothing. It is refused when the item is not on sale anymore or the buyer can't afford it.
+	Purchase(ctx context.Context, id int64, buyerID int64) error
+	// AddCategory, RenameCategory, MoveCategory and DeleteCategory record log in the audit trail with the change.
+	// The target of the log of AddCategory is set to the new category.
+	AddCategory(ctx context.Context, cat domain.Category, log domain.AuditLog) (domain.Category, error)
+	RenameCategory(ctx context.Context, id int64, name string, log domain.AuditLog) error
+	// MoveCategory sets the parent of the category. A parentID of 0 makes it a root category.
+	// Moving a category under itself or one of its descendants is refused.
+	MoveCategory(ctx context.Context, id int64, parentID int64, log domain.AuditLog) error
+	// DeleteCategory is refused while items or subcategories reference the category.
+	DeleteCategory(ctx context.Context, id int64, log domain.AuditLog) error
 }
 
 type ItemDBRepository struct {
-	*sql.DB
+	*DB
+
+	addItem          *sql.Stmt
+	getItem          *sql.Stmt
+	getItemImage     *sql.Stmt
+	getItemsByStatus *sql.Stmt
+	getItemsByUserID *sql.Stmt
+	updateItemStatus *sql.Stmt
+	getCategory      *sql.Stmt
+	getCategories    *sql.Stmt
+
+	getOnSaleItemsInCategory *sql.Stmt
+	getItems                 *sql.Stmt
+	addCategory              *sql.Stmt
+	renameCategory           *sql.Stmt
+	moveCategory             *sql.Stmt
+	deleteCategory           *sql.Stmt
+	hasItemsInCategory       *sql.Stmt
+	listItem                 *sql.Stmt
+	purchaseItem             *sql.Stmt
+	updateBalanceBy          *sql.Stmt
+	addEvent                 *sql.Stmt
+	getItemStatus            *sql.Stmt
+	addModeration            *sql.Stmt
+	deleteModeration         *sql.Stmt
+	countReportsByReporter   *sql.Stmt
+	addReport                *sql.Stmt
+	countOpenReports         *sql.Stmt
+	resolveReports           *sql.Stmt
+	addAuditLog              *sql.Stmt
 }
 
-func NewItemRepository(db *sql.DB) ItemRepository {
-	return &ItemDBRepository{DB: db}
+// NewItemRepository prepares the statements of the repository once. They are reused by every request.
+func NewItemRepository(ctx context.Context, db *DB) (ItemRepository, error) {
+	p := db.preparer(ctx)
+	r := &ItemDBRepository{
+		DB:               db,
+		addItem:          p.write("INSERT INTO items (name, price, description, category_id, seller_id, image, status) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		getItem:          p.read("SELECT * FROM items WHERE id = ?"),
+		getItemImage:     p.read("SELECT image FROM items WHERE id = ?"),
+		getItemsByStatus: p.read("SELECT * FROM items WHERE status = ? ORDER BY updated_at desc"),
+		getItemsByUserID: p.read("SELECT * FROM items WHERE seller_id = ?"),
+		updateItemStatus: p.write("UPDATE items SET status = ? WHERE id = ?"),
+		getCategory:      p.read("SELECT id, name, COALESCE(parent_id, 0) FROM category WHERE id = ?"),
+		getCategories:    p.readAll("SELECT id, name, COALESCE(parent_id, 0) FROM category"),
+
+		getOnSaleItemsInCategory: p.read(`WITH RECURSIVE descendants(id) AS (
+				SELECT ? UNION ALL SELECT category.id FROM category JOIN descendants ON category.parent_id = descendants.id
+			)
+			SELECT * FROM items WHERE status = ? AND category_id IN descendants ORDER BY updated_at desc`),
+		// every filter is part of the statement and disabled by its zero value, so that it can be prepared once
+		getItems: p.read(`WITH RECURSIVE selected(id) AS (
+				SELECT value FROM json_each(?) UNION SELECT category.id FROM category JOIN selected ON category.parent_id = selected.id
+			)
+			SELECT * FROM items
+			WHERE status = ?
+				AND (json_array_length(?) = 0 OR category_id IN selected)
+				AND (? IS NULL OR price >= ?)
+				AND (? IS NULL OR price <= ?)
+				AND (? = 0 OR seller_id = ?)
+				AND (? = '' OR created_at > ?)
+			ORDER BY updated_at desc`),
+		addCategory:    p.write("INSERT INTO category (name, parent_id) VALUES (?, NULLIF(?, 0))"),
+		renameCategory: p.write("UPDATE category SET name = ? WHERE id = ?"),
+		// the parent must not be the category or one of its descendants, or the tree would have a cycle
+		moveCategory: p.write(`UPDATE category SET parent_id = NULLIF(?, 0) WHERE id = ? AND ? NOT IN (
+				WITH RECURSIVE descendants(id) AS (
+					SELECT ? UNION ALL SELECT category.id FROM category JOIN descendants ON category.parent_id = descendants.id
+				)
+				SELECT id FROM descendants
+			)`),
+		deleteCategory: p.write(`DELETE FROM category WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM items WHERE category_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM category AS child WHERE child.parent_id = ?)`),
+		hasItemsInCategory: p.read("SELECT EXISTS (SELECT 1 FROM items WHERE category_id = ?)"),
+		// the status is checked again in the update, so that concurrent requests can't both pass the checks before
+		listItem:        p.write("UPDATE items SET status = ? WHERE id = ? AND status = ? RETURNING seller_id, name, price"),
+		purchaseItem:    p.write("UPDATE items SET status = ? WHERE id = ? AND status = ? AND seller_id != ? RETURNING seller_id, name, price"),
+		updateBalanceBy: p.write("UPDATE users SET balance = balance + ? WHERE id = ? RETURNING balance"),
+		addEvent:        p.write(addEventQuery),
+		getItemStatus:   p.write("SELECT status FROM items WHERE id = ?"),
+		addModeration: p.write(`INSERT INTO item_moderations (item_id, previous_status) VALUES (?, ?)
+			ON CONFLICT (item_id) DO UPDATE SET previous_status = excluded.previous_status`),
+		deleteModeration:       p.write("DELETE FROM item_moderations WHERE item_id = ? RETURNING previous_status"),
+		addReport:              p.write(addReportQuery),
+		countReportsByReporter: p.write(countReportsByReporterSinceQuery),
+		countOpenReports:       p.write(countOpenReportsQuery),
+		resolveReports:         p.write("UPDATE reports SET resolved_at = DATETIME('now', 'localtime') WHERE item_id = ? AND resolved_at IS NULL"),
+		addAuditLog:            p.write(addAuditLogQuery),
+	}
+	return r, p.err
 }
 
 func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
-	if _, err := r.ExecContext(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, image, status) VALUES (?, ?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Image, item.Status); err != nil {
+	res, err := r.addItem.ExecContext(ctx, item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Image, item.Status)
+	if err != nil {
+		return domain.Item{}, translateError(err, "item")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
 		return domain.Item{}, err
 	}
-	// TODO: if other insert query is executed at the same time, it might return wrong id
-	// http.StatusConflict(409) 既に同じIDがあった場合
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE rowid = LAST_INSERT_ROWID()")
-
-	var res domain.Item
-	return res, row.Scan(&res.ID, &res.Name, &res.Price, &res.Description, &res.CategoryID, &res.UserID, &res.Image, &res.Status, &res.CreatedAt, &res.UpdatedAt)
+	return r.GetItem(ctx, id)
 }
 
-func (r *ItemDBRepository) GetItem(ctx context.Context, id int32) (domain.Item, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE id = ?", id)
+func (r *ItemDBRepository) GetItem(ctx context.Context, id int64) (domain.Item, error) {
+	row := r.getItem.QueryRowContext(ctx, id)
 
 	var item domain.Item
-	return item, row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt)
+	err := row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt)
+	return item, translateError(err, "item")
 }
 
-func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int32) ([]byte, error) {
-	row := r.QueryRowContext(ctx, "SELECT image FROM items WHERE id = ?", id)
+func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int64) ([]byte, error) {
+	row := r.getItemImage.QueryRowContext(ctx, id)
 	var image []byte
-	return image, row.Scan(&image)
+	return image, translateError(row.Scan(&image), "item")
 }
 
 func (r *ItemDBRepository) GetOnSaleItems(ctx context.Context) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE status = ? ORDER BY updated_at desc", domain.ItemStatusOnSale)
+	return r.GetItemsByStatus(ctx, domain.ItemStatusOnSale)
+}
+
+func (r *ItemDBRepository) GetItems(ctx context.Context, filter domain.ItemFilter) ([]domain.Item, error) {
+	categoryIDs := filter.CategoryIDs
+	if categoryIDs == nil {
+		// json_array_length(null) is null, not 0
+		categoryIDs = []int64{}
+	}
+	categories, err := json.Marshal(categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	var createdAfter string
+	if !filter.CreatedAfter.IsZero() {
+		createdAfter = filter.CreatedAfter.In(time.Local).Format(sqliteTimeLayout)
+	}
+
+	rows, err := r.getItems.QueryContext(ctx, categories, filter.Status, categories,
+		filter.MinPrice, filter.MinPrice, filter.MaxPrice, filter.MaxPrice,
+		filter.SellerID, filter.SellerID, createdAfter, createdAfter)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +454,7 @@ func (r *ItemDBRepository) GetOnSaleItems(ctx context.Context) ([]domain.Item, e
 }
 
 func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE seller_id = ?", userID)
+	rows, err := r.getItemsByUserID.QueryContext(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -133,22 +474,200 @@ func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64) (
 	return items, nil
 }
 
-func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int32, status domain.ItemStatus) error {
-	if _, err := r.ExecContext(ctx, "UPDATE items SET status = ? WHERE id = ?", status, id); err != nil {
+func (r *ItemDBRepository) GetItemsByStatus(ctx context.Context, status domain.ItemStatus) ([]domain.Item, error) {
+	rows, err := r.getItemsByStatus.QueryContext(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.Item
+	for rows.Next() {
+		var item domain.Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+	res, err := r.updateItemStatus.ExecContext(ctx, status, id)
+	if err != nil {
 		return err
 	}
+	return requireAffected(res, "item")
+}
+
+func (r *ItemDBRepository) Moderate(ctx context.Context, id int64, status domain.ItemStatus, log domain.AuditLog) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous domain.ItemStatus
+	if err := tx.StmtContext(ctx, r.getItemStatus).QueryRowContext(ctx, id).Scan(&previous); err != nil {
+		return translateError(err, "item")
+	}
+	if err := r.moderate(ctx, tx, id, previous, status); err != nil {
+		return err
+	}
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moderate sets the status of an item whose status is previous in tx, keeping previous unless it is under moderation already.
+func (r *ItemDBRepository) moderate(ctx context.Context, tx *sql.Tx, id int64, previous, status domain.ItemStatus) error {
+	if previous != domain.ItemStatusHidden && previous != domain.ItemStatusModerated {
+		if _, err := tx.StmtContext(ctx, r.addModeration).ExecContext(ctx, id, previous); err != nil {
+			return err
+		}
+	}
+	_, err := tx.StmtContext(ctx, r.updateItemStatus).ExecContext(ctx, status, id)
+	return err
+}
+
+func (r *ItemDBRepository) Restore(ctx context.Context, id int64, log domain.AuditLog) (domain.ItemStatus, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status domain.ItemStatus
+	if err := tx.StmtContext(ctx, r.deleteModeration).QueryRowContext(ctx, id).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.NewPreconditionFailedError("item is not under moderation")
+		}
+		return 0, err
+	}
+	if _, err := tx.StmtContext(ctx, r.updateItemStatus).ExecContext(ctx, status, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.StmtContext(ctx, r.resolveReports).ExecContext(ctx, id); err != nil {
+		return 0, err
+	}
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return 0, err
+	}
+	return status, tx.Commit()
+}
+
+func (r *ItemDBRepository) Report(ctx context.Context, report domain.Report, limits domain.ReportLimits) (bool, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// the write lock is held from here, so concurrent reports are counted one after another
+	since := time.Now().Add(-limits.Window).Format(sqliteTimeLayout)
+	var filed int64
+	if err := tx.StmtContext(ctx, r.countReportsByReporter).QueryRowContext(ctx, report.ReporterID, since).Scan(&filed); err != nil {
+		return false, err
+	}
+	if filed >= limits.PerReporter {
+		return false, domain.NewTooManyRequestsError("too many reports")
+	}
+	if _, err := tx.StmtContext(ctx, r.addReport).ExecContext(ctx, report.ItemID, report.ReporterID, report.Reason, report.Comment); err != nil {
+		return false, translateError(err, "report")
+	}
+	var reporters int64
+	if err := tx.StmtContext(ctx, r.countOpenReports).QueryRowContext(ctx, report.ItemID).Scan(&reporters); err != nil {
+		return false, err
+	}
+	var status domain.ItemStatus
+	if err := tx.StmtContext(ctx, r.getItemStatus).QueryRowContext(ctx, report.ItemID).Scan(&status); err != nil {
+		return false, translateError(err, "item")
+	}
+
+	hide := reporters >= limits.HideThreshold && status == domain.ItemStatusOnSale
+	if hide {
+		if err := r.moderate(ctx, tx, report.ItemID, status, domain.ItemStatusHidden); err != nil {
+			return false, err
+		}
+	}
+	return hide, tx.Commit()
+}
+
+func (r *ItemDBRepository) ListItem(ctx context.Context, id int64) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	e := domain.ItemListed{ItemID: id}
+	row := tx.StmtContext(ctx, r.listItem).QueryRowContext(ctx, domain.ItemStatusOnSale, id, domain.ItemStatusInitial)
+	if err := row.Scan(&e.SellerID, &e.Name, &e.Price); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.NewPreconditionFailedError("item is not a draft")
+		}
+		return err
+	}
+	if err := addEvents(ctx, tx.StmtContext(ctx, r.addEvent), e); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.signalOutbox()
+	return nil
+}
+
+func (r *ItemDBRepository) Purchase(ctx context.Context, id int64, buyerID int64) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	e := domain.ItemSold{ItemID: id, BuyerID: buyerID}
+	row := tx.StmtContext(ctx, r.purchaseItem).QueryRowContext(ctx, domain.ItemStatusSoldOut, id, domain.ItemStatusOnSale, buyerID)
+	if err := row.Scan(&e.SellerID, &e.Name, &e.Price); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.NewPreconditionFailedError("item is not on sale")
+		}
+		return err
+	}
+
+	updateBalanceBy := tx.StmtContext(ctx, r.updateBalanceBy)
+	if err := updateBalanceBy.QueryRowContext(ctx, -e.Price, buyerID).Scan(&e.BuyerBalance); err != nil {
+		return translateError(err, "user")
+	}
+	if e.BuyerBalance < 0 {
+		return domain.NewPreconditionFailedError("insufficient balance")
+	}
+	if err := updateBalanceBy.QueryRowContext(ctx, e.Price, e.SellerID).Scan(&e.SellerBalance); err != nil {
+		return translateError(err, "user")
+	}
+
+	if err := addEvents(ctx, tx.StmtContext(ctx, r.addEvent), e); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.signalOutbox()
 	return nil
 }
 
 func (r *ItemDBRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM category WHERE id = ?", id)
+	row := r.getCategory.QueryRowContext(ctx, id)
 
 	var cat domain.Category
-	return cat, row.Scan(&cat.ID, &cat.Name)
+	return cat, translateError(row.Scan(&cat.ID, &cat.Name, &cat.ParentID), "category")
 }
 
 func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM category")
+	rows, err := r.getCategories.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -157,7 +676,7 @@ func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category
 	var cats []domain.Category
 	for rows.Next() {
 		var cat domain.Category
-		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.ParentID); err != nil {
 			return nil, err
 		}
 		cats = append(cats, cat)
@@ -167,3 +686,132 @@ func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category
 	}
 	return cats, nil
 }
+
+func (r *ItemDBRepository) GetOnSaleItemsInCategory(ctx context.Context, categoryID int64) ([]domain.Item, error) {
+	rows, err := r.getOnSaleItemsInCategory.QueryContext(ctx, categoryID, domain.ItemStatusOnSale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.Item
+	for rows.Next() {
+		var item domain.Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *ItemDBRepository) AddCategory(ctx context.Context, cat domain.Category, log domain.AuditLog) (domain.Category, error) {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Category{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(ctx, r.addCategory).ExecContext(ctx, cat.Name, cat.ParentID)
+	if err != nil {
+		return domain.Category{}, translateError(err, "category")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return domain.Category{}, err
+	}
+	log.TargetID = id
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return domain.Category{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Category{}, err
+	}
+	return r.GetCategory(ctx, id)
+}
+
+func (r *ItemDBRepository) RenameCategory(ctx context.Context, id int64, name string, log domain.AuditLog) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(ctx, r.renameCategory).ExecContext(ctx, name, id)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res, "category"); err != nil {
+		return err
+	}
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ItemDBRepository) MoveCategory(ctx context.Context, id int64, parentID int64, log domain.AuditLog) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(ctx, r.moveCategory).ExecContext(ctx, parentID, id, parentID, id)
+	if err != nil {
+		return translateError(err, "category")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := r.GetCategory(ctx, id); err != nil {
+			return err
+		}
+		return domain.NewPreconditionFailedError("category can't be moved under itself or its descendants")
+	}
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ItemDBRepository) DeleteCategory(ctx context.Context, id int64, log domain.AuditLog) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(ctx, r.deleteCategory).ExecContext(ctx, id, id, id)
+	if err != nil {
+		return translateError(err, "category")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// find out why nothing was deleted
+	if _, err := r.GetCategory(ctx, id); err != nil {
+		return err
+	}
+	var hasItems bool
+	if err := r.hasItemsInCategory.QueryRowContext(ctx, id).Scan(&hasItems); err != nil {
+		return err
+	}
+	if hasItems {
+		return domain.NewConflictError("category is used by items")
+	}
+	return domain.NewConflictError("category has subcategories")
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type SavedSearchRepository interface {
+	AddSavedSearch(ctx context.Context, search domain.SavedSearch) (int64, error)
+	GetSavedSearchesByUserID(ctx context.Context, userID int64) ([]domain.SavedSearch, error)
+	// GetSavedSearches returns the saved searches of every user.
+	GetSavedSearches(ctx context.Context) ([]domain.SavedSearch, error)
+	// DeleteSavedSearch deletes a saved search of the user. Saved searches of other users are not found.
+	DeleteSavedSearch(ctx context.Context, id, userID int64) error
+}
+
+type SavedSearchDBRepository struct {
+	*DB
+
+	addSavedSearch           *sql.Stmt
+	getSavedSearchesByUserID *sql.Stmt
+	getSavedSearches         *sql.Stmt
+	deleteSavedSearch        *sql.Stmt
+}
+
+func NewSavedSearchRepository(ctx context.Context, db *DB) (SavedSearchRepository, error) {
+	p := db.preparer(ctx)
+	r := &SavedSearchDBRepository{
+		DB:                       db,
+		addSavedSearch:           p.write("INSERT INTO saved_searches (user_id, query, category_ids, min_price, max_price) VALUES (?, ?, ?, ?, ?)"),
+		getSavedSearchesByUserID: p.read("SELECT id, user_id, query, category_ids, min_price, max_price, created_at FROM saved_searches WHERE user_id = ? ORDER BY id"),
+		// every listing is matched against all of them
+		getSavedSearches:  p.readAll("SELECT id, user_id, query, category_ids, min_price, max_price, created_at FROM saved_searches ORDER BY id"),
+		deleteSavedSearch: p.write("DELETE FROM saved_searches WHERE id = ? AND user_id = ?"),
+	}
+	return r, p.err
+}
+
+func (r *SavedSearchDBRepository) AddSavedSearch(ctx context.Context, search domain.SavedSearch) (int64, error) {
+	categoryIDs := search.CategoryIDs
+	if categoryIDs == nil {
+		categoryIDs = []int64{}
+	}
+	categories, err := json.Marshal(categoryIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := r.addSavedSearch.ExecContext(ctx, search.UserID, search.Query, categories, search.MinPrice, search.MaxPrice)
+	if err != nil {
+		return 0, translateError(err, "saved search")
+	}
+	return res.LastInsertId()
+}
+
+func (r *SavedSearchDBRepository) GetSavedSearchesByUserID(ctx context.Context, userID int64) ([]domain.SavedSearch, error) {
+	rows, err := r.getSavedSearchesByUserID.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSavedSearches(rows)
+}
+
+func (r *SavedSearchDBRepository) GetSavedSearches(ctx context.Context) ([]domain.SavedSearch, error) {
+	rows, err := r.getSavedSearches.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanSavedSearches(rows)
+}
+
+func (r *SavedSearchDBRepository) DeleteSavedSearch(ctx context.Context, id, userID int64) error {
+	res, err := r.deleteSavedSearch.ExecContext(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "saved search")
+}
+
+func scanSavedSearches(rows *sql.Rows) ([]domain.SavedSearch, error) {
+	defer rows.Close()
+
+	var searches []domain.SavedSearch
+	for rows.Next() {
+		var (
+			s          domain.SavedSearch
+			categories []byte
+		)
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Query, &categories, &s.MinPrice, &s.MaxPrice, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(categories, &s.CategoryIDs); err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type SearchRepository interface {
+	// GetListedItems returns the items on sale without their images.
+	GetListedItems(ctx context.Context) ([]domain.Item, error)
+	GetSearchQueries(ctx context.Context) ([]domain.SearchQuery, error)
+	// AddSearchQueries adds the counts to the recorded queries.
+	AddSearchQueries(ctx context.Context, counts map[string]int64, searchedAt time.Time) error
+}
+
+type SearchDBRepository struct {
+	*DB
+
+	getListedItems   *sql.Stmt
+	getSearchQueries *sql.Stmt
+	addSearchQuery   *sql.Stmt
+}
+
+func NewSearchRepository(ctx context.Context, db *DB) (SearchRepository, error) {
+	p := db.preparer(ctx)
+	r := &SearchDBRepository{
+		DB:               db,
+		getListedItems:   p.read("SELECT id, name, price, description, category_id, seller_id, status, created_at, updated_at FROM items WHERE status = ?"),
+		getSearchQueries: p.readAll("SELECT query, count FROM search_queries"),
+		addSearchQuery: p.write(`INSERT INTO search_queries (query, count, last_searched_at) VALUES (?, ?, ?)
+			ON CONFLICT (query) DO UPDATE SET count = count + excluded.count, last_searched_at = excluded.last_searched_at`),
+	}
+	return r, p.err
+}
+
+func (r *SearchDBRepository) GetListedItems(ctx context.Context) ([]domain.Item, error) {
+	rows, err := r.getListedItems.QueryContext(ctx, domain.ItemStatusOnSale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.Item
+	for rows.Next() {
+		var item domain.Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *SearchDBRepository) GetSearchQueries(ctx context.Context) ([]domain.SearchQuery, error) {
+	rows, err := r.getSearchQueries.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []domain.SearchQuery
+	for rows.Next() {
+		var q domain.SearchQuery
+		if err := rows.Scan(&q.Query, &q.Count); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+func (r *SearchDBRepository) AddSearchQueries(ctx context.Context, counts map[string]int64, searchedAt time.Time) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := tx.StmtContext(ctx, r.addSearchQuery)
+	for query, n := range counts {
+		if _, err := stmt.ExecContext(ctx, query, n, searchedAt.Format(sqliteTimeLayout)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
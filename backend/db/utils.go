@@ -15,18 +15,13 @@ import (
 	"github.com/pkg/errors"
 )
 
-func Initialize(ctx context.Context, db *sql.DB) error {
-	root, err := os.Getwd()
+func Initialize(ctx context.Context, db *sql.DB, sqlDir string) error {
+	err := putDataSql(sqlDir)
 	if err != nil {
 		return err
 	}
 
-	err = putDataSql()
-	if err != nil {
-		return err
-	}
-
-	pattern := filepath.Join(root, "sql", "*.sql")
+	pattern := filepath.Join(sqlDir, "*.sql")
 	paths, err := filepath.Glob(pattern)
 	if err != nil {
 		return err
@@ -46,17 +41,13 @@ func Initialize(ctx context.Context, db *sql.DB) error {
 		}
 	}
 
-	return nil
+	// the migrations run after the data so that the data is loaded into the base schema it was written for
+	return Migrate(ctx, db, sqlDir)
 }
 
-func putDataSql() error {
-	root, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-
-	dpath := filepath.Join(root, "sql", "10_data.sql")
-	_, err = os.Stat(dpath)
+func putDataSql(sqlDir string) error {
+	dpath := filepath.Join(sqlDir, "10_data.sql")
+	_, err := os.Stat(dpath)
 	if os.IsNotExist(err) {
 		url := "https://storage.googleapis.com/ku-mu-public/hackathon-2023/10_data.sql"
 		err = download(dpath, url)
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type WebhookRepository interface {
+	// AddWebhook stores the webhook and records log in the audit trail with it, setting its target to the webhook.
+	AddWebhook(ctx context.Context, webhook domain.Webhook, log domain.AuditLog) (int64, error)
+	GetWebhook(ctx context.Context, id int64) (domain.Webhook, error)
+	GetWebhooksByUserID(ctx context.Context, userID int64) ([]domain.Webhook, error)
+	// GetWebhooksByEventType returns the webhooks of every user which are sent the events of the type.
+	GetWebhooksByEventType(ctx context.Context, t domain.EventType) ([]domain.Webhook, error)
+	// DeleteWebhook deletes the webhook and its deliveries, and records log in the audit trail.
+	DeleteWebhook(ctx context.Context, id int64, log domain.AuditLog) error
+
+	// AddDeliveries stores the deliveries at once, to be sent right away.
+	AddDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error
+	// GetDeliveriesByWebhookID returns up to limit deliveries of the webhook, the newest first.
+	GetDeliveriesByWebhookID(ctx context.Context, webhookID int64, limit int) ([]domain.WebhookDelivery, error)
+	// GetPendingDeliveries returns up to limit pending deliveries which are due at now, the longest due first.
+	GetPendingDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error)
+	MarkDeliverySucceeded(ctx context.Context, id int64, responseStatus int, at time.Time) error
+	// RetryDelivery records a failed attempt and sends the delivery again at next.
+	RetryDelivery(ctx context.Context, id int64, responseStatus int, lastError string, next time.Time) error
+	// MarkDeliveryDead records the last failed attempt and moves the delivery to the dead letter state.
+	MarkDeliveryDead(ctx context.Context, id int64, responseStatus int, lastError string) error
+	// RedeliverDelivery makes a delivery of the webhook pending again with fresh attempts, to be sent at the time.
+	RedeliverDelivery(ctx context.Context, id, webhookID int64, at time.Time) error
+}
+
+type WebhookDBRepository struct {
+	*DB
+
+	addWebhook               *sql.Stmt
+	getWebhook               *sql.Stmt
+	getWebhooksByUserID      *sql.Stmt
+	getWebhooksByEventType   *sql.Stmt
+	deleteDeliveries         *sql.Stmt
+	deleteWebhook            *sql.Stmt
+	addDelivery              *sql.Stmt
+	getDeliveriesByWebhookID *sql.Stmt
+	getPendingDeliveries     *sql.Stmt
+	markDeliverySucceeded    *sql.Stmt
+	retryDelivery            *sql.Stmt
+	markDeliveryDead         *sql.Stmt
+	redeliverDelivery        *sql.Stmt
+	addAuditLog              *sql.Stmt
+}
+
+func NewWebhookRepository(ctx context.Context, db *DB) (WebhookRepository, error) {
+	p := db.preparer(ctx)
+	r := &WebhookDBRepository{
+		DB:                  db,
+		addWebhook:          p.write("INSERT INTO webhooks (user_id, url, event_types, secret) VALUES (?, ?, ?, ?)"),
+		getWebhook:          p.read("SELECT id, user_id, url, event_types, secret, created_at FROM webhooks WHERE id = ?"),
+		getWebhooksByUserID: p.read("SELECT id, user_id, url, event_types, secret, created_at FROM webhooks WHERE user_id = ? ORDER BY id"),
+		// every event is matched against all of them, and there are few
+		getWebhooksByEventType: p.readAll(`SELECT id, user_id, url, event_types, secret, created_at FROM webhooks
+			WHERE EXISTS (SELECT 1 FROM json_each(event_types) WHERE value = ?) ORDER BY id`),
+		deleteDeliveries: p.write("DELETE FROM webhook_deliveries WHERE webhook_id = ?"),
+		deleteWebhook:    p.write("DELETE FROM webhooks WHERE id = ?"),
+		addDelivery:      p.write("INSERT INTO webhook_deliveries (webhook_id, event_type, payload) VALUES (?, ?, ?)"),
+		getDeliveriesByWebhookID: p.read(`SELECT id, webhook_id, event_type, payload, status, attempts, COALESCE(response_status, 0),
+				COALESCE(last_error, ''), next_attempt_at, COALESCE(delivered_at, ''), created_at
+			FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`),
+		getPendingDeliveries: p.read(`SELECT id, webhook_id, event_type, payload, status, attempts, COALESCE(response_status, 0),
+				COALESCE(last_error, ''), next_attempt_at, COALESCE(delivered_at, ''), created_at
+			FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`),
+		markDeliverySucceeded: p.write(`UPDATE webhook_deliveries SET status = 'succeeded', attempts = attempts + 1,
+			response_status = NULLIF(?, 0), last_error = NULL, delivered_at = ? WHERE id = ?`),
+		retryDelivery: p.write(`UPDATE webhook_deliveries SET attempts = attempts + 1,
+			response_status = NULLIF(?, 0), last_error = ?, next_attempt_at = ? WHERE id = ?`),
+		markDeliveryDead: p.write(`UPDATE webhook_deliveries SET status = 'dead', attempts = attempts + 1,
+			response_status = NULLIF(?, 0), last_error = ? WHERE id = ?`),
+		redeliverDelivery: p.write(`UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = ?
+			WHERE id = ? AND webhook_id = ?`),
+		addAuditLog: p.write(addAuditLogQuery),
+	}
+	return r, p.err
+}
+
+func (r *WebhookDBRepository) AddWebhook(ctx context.Context, webhook domain.Webhook, log domain.AuditLog) (int64, error) {
+	eventTypes, err := json.Marshal(webhook.EventTypes)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(ctx, r.addWebhook).ExecContext(ctx, webhook.UserID, webhook.URL, eventTypes, webhook.Secret)
+	if err != nil {
+		return 0, translateError(err, "webhook")
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	log.TargetID = id
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *WebhookDBRepository) GetWebhook(ctx context.Context, id int64) (domain.Webhook, error) {
+	row := r.getWebhook.QueryRowContext(ctx, id)
+
+	var (
+		webhook    domain.Webhook
+		eventTypes []byte
+	)
+	if err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &eventTypes, &webhook.Secret, &webhook.CreatedAt); err != nil {
+		return webhook, translateError(err, "webhook")
+	}
+	return webhook, json.Unmarshal(eventTypes, &webhook.EventTypes)
+}
+
+func (r *WebhookDBRepository) GetWebhooksByUserID(ctx context.Context, userID int64) ([]domain.Webhook, error) {
+	rows, err := r.getWebhooksByUserID.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+func (r *WebhookDBRepository) GetWebhooksByEventType(ctx context.Context, t domain.EventType) ([]domain.Webhook, error) {
+	rows, err := r.getWebhooksByEventType.QueryContext(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+func (r *WebhookDBRepository) DeleteWebhook(ctx context.Context, id int64, log domain.AuditLog) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.StmtContext(ctx, r.deleteDeliveries).ExecContext(ctx, id); err != nil {
+		return err
+	}
+	res, err := tx.StmtContext(ctx, r.deleteWebhook).ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res, "webhook"); err != nil {
+		return err
+	}
+	if err := addAuditLog(ctx, tx.StmtContext(ctx, r.addAuditLog), log); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *WebhookDBRepository) AddDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	tx, err := r.Write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := tx.StmtContext(ctx, r.addDelivery)
+	for _, d := range deliveries {
+		if _, err := stmt.ExecContext(ctx, d.WebhookID, d.EventType, d.Payload); err != nil {
+			return translateError(err, "webhook delivery")
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *WebhookDBRepository) GetDeliveriesByWebhookID(ctx context.Context, webhookID int64, limit int) ([]domain.WebhookDelivery, error) {
+	rows, err := r.getDeliveriesByWebhookID.QueryContext(ctx, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (r *WebhookDBRepository) GetPendingDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	rows, err := r.getPendingDeliveries.QueryContext(ctx, now.Format(sqliteTimeLayout), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (r *WebhookDBRepository) MarkDeliverySucceeded(ctx context.Context, id int64, responseStatus int, at time.Time) error {
+	res, err := r.markDeliverySucceeded.ExecContext(ctx, responseStatus, at.Format(sqliteTimeLayout), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "webhook delivery")
+}
+
+func (r *WebhookDBRepository) RetryDelivery(ctx context.Context, id int64, responseStatus int, lastError string, next time.Time) error {
+	res, err := r.retryDelivery.ExecContext(ctx, responseStatus, lastError, next.Format(sqliteTimeLayout), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "webhook delivery")
+}
+
+func (r *WebhookDBRepository) MarkDeliveryDead(ctx context.Context, id int64, responseStatus int, lastError string) error {
+	res, err := r.markDeliveryDead.ExecContext(ctx, responseStatus, lastError, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "webhook delivery")
+}
+
+func (r *WebhookDBRepository) RedeliverDelivery(ctx context.Context, id, webhookID int64, at time.Time) error {
+	res, err := r.redeliverDelivery.ExecContext(ctx, at.Format(sqliteTimeLayout), id, webhookID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "webhook delivery")
+}
+
+func scanWebhooks(rows *sql.Rows) ([]domain.Webhook, error) {
+	defer rows.Close()
+
+	var webhooks []domain.Webhook
+	for rows.Next() {
+		var (
+			webhook    domain.Webhook
+			eventTypes []byte
+		)
+		if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &eventTypes, &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(eventTypes, &webhook.EventTypes); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]domain.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		var d domain.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus,
+			&d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
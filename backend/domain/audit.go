@@ -0,0 +1,29 @@
+package domain
+
+type AuditAction string
+
+const (
+	AuditActionSuspendUser    AuditAction = "suspend_user"
+	AuditActionUnsuspendUser  AuditAction = "unsuspend_user"
+	AuditActionTakeDownItem   AuditAction = "take_down_item"
+	AuditActionRestoreItem    AuditAction = "restore_item"
+	AuditActionAdjustBalance  AuditAction = "adjust_balance"
+	AuditActionCreateCategory AuditAction = "create_category"
+	AuditActionRenameCategory AuditAction = "rename_category"
+	AuditActionMoveCategory   AuditAction = "move_category"
+	AuditActionDeleteCategory AuditAction = "delete_category"
+	AuditActionCreateWebhook  AuditAction = "create_webhook"
+	AuditActionDeleteWebhook  AuditAction = "delete_webhook"
+)
+
+// AuditLog records an action taken by an admin.
+type AuditLog struct {
+	ID         int64
+	AdminID    int64
+	Action     AuditAction
+	TargetType string
+	TargetID   int64
+	Amount     int64
+	Reason     string
+	CreatedAt  string
+}
@@ -0,0 +1,13 @@
+package domain
+
+// Comment is a public message on an item, such as a question to the seller and the answer.
+type Comment struct {
+	ID     int64
+	ItemID int64
+	UserID int64
+	// UserName is the name of the author.
+	UserName  string
+	Body      string
+	CreatedAt string
+	UpdatedAt string
+}
@@ -0,0 +1,56 @@
+package domain
+
+// NotFoundError is returned when the requested resource does not exist.
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string { return e.Message }
+
+// ConflictError is returned when the request conflicts with the current state, e.g. a duplicated key.
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string { return e.Message }
+
+// PreconditionFailedError is returned when the resource is not in a state that allows the operation.
+type PreconditionFailedError struct {
+	Message string
+}
+
+func (e *PreconditionFailedError) Error() string { return e.Message }
+
+// ForbiddenError is returned when the caller is not allowed to perform the operation.
+type ForbiddenError struct {
+	Message string
+}
+
+func (e *ForbiddenError) Error() string { return e.Message }
+
+// TooManyRequestsError is returned when the caller did the operation too many times recently.
+type TooManyRequestsError struct {
+	Message string
+}
+
+func (e *TooManyRequestsError) Error() string { return e.Message }
+
+func NewNotFoundError(msg string) error {
+	return &NotFoundError{Message: msg}
+}
+
+func NewConflictError(msg string) error {
+	return &ConflictError{Message: msg}
+}
+
+func NewPreconditionFailedError(msg string) error {
+	return &PreconditionFailedError{Message: msg}
+}
+
+func NewForbiddenError(msg string) error {
+	return &ForbiddenError{Message: msg}
+}
+
+func NewTooManyRequestsError(msg string) error {
+	return &TooManyRequestsError{Message: msg}
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type EventType string
+
+const (
+	EventTypeItemListed      EventType = "item_listed"
+	EventTypeItemSold        EventType = "item_sold"
+	EventTypeBalanceToppedUp EventType = "balance_topped_up"
+	EventTypeBalanceAdjusted EventType = "balance_adjusted"
+	EventTypeUserRegistered  EventType = "user_registered"
+)
+
+// EventTypes are all the types, in the order they are listed to users.
+var EventTypes = []EventType{EventTypeItemListed, EventTypeItemSold, EventTypeBalanceToppedUp, EventTypeBalanceAdjusted, EventTypeUserRegistered}
+
+func (t EventType) Valid() bool {
+	for _, typ := range EventTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something which happened in the marketplace. Events are stored in the outbox together with the change
+// and dispatched to their subscribers afterwards, as JSON.
+type Event interface {
+	EventType() EventType
+}
+
+// ItemListed is raised when the seller puts an item on sale.
+type ItemListed struct {
+	ItemID   int64  `json:"item_id"`
+	SellerID int64  `json:"seller_id"`
+	Name     string `json:"name"`
+	Price    int64  `json:"price"`
+}
+
+// ItemSold is raised when an item is purchased. The balances are the ones after the purchase.
+type ItemSold struct {
+	ItemID        int64  `json:"item_id"`
+	Name          string `json:"name"`
+	Price         int64  `json:"price"`
+	SellerID      int64  `json:"seller_id"`
+	BuyerID       int64  `json:"buyer_id"`
+	SellerBalance int64  `json:"seller_balance"`
+	BuyerBalance  int64  `json:"buyer_balance"`
+}
+
+// BalanceToppedUp is raised when a user adds to the own balance.
+type BalanceToppedUp struct {
+	UserID  int64 `json:"user_id"`
+	Amount  int64 `json:"amount"`
+	Balance int64 `json:"balance"`
+}
+
+// BalanceAdjusted is raised when an admin corrects the balance of a user.
+type BalanceAdjusted struct {
+	UserID  int64 `json:"user_id"`
+	Amount  int64 `json:"amount"`
+	Balance int64 `json:"balance"`
+}
+
+type UserRegistered struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+func (ItemListed) EventType() EventType      { return EventTypeItemListed }
+func (ItemSold) EventType() EventType        { return EventTypeItemSold }
+func (BalanceToppedUp) EventType() EventType { return EventTypeBalanceToppedUp }
+func (BalanceAdjusted) EventType() EventType { return EventTypeBalanceAdjusted }
+func (UserRegistered) EventType() EventType  { return EventTypeUserRegistered }
+
+var eventDecoders = map[EventType]func(payload []byte) (Event, error){
+	EventTypeItemListed:      decodeEvent[ItemListed],
+	EventTypeItemSold:        decodeEvent[ItemSold],
+	EventTypeBalanceToppedUp: decodeEvent[BalanceToppedUp],
+	EventTypeBalanceAdjusted: decodeEvent[BalanceAdjusted],
+	EventTypeUserRegistered:  decodeEvent[UserRegistered],
+}
+
+// DecodeEvent decodes the payload of an event of the type.
+func DecodeEvent(t EventType, payload []byte) (Event, error) {
+	decode, ok := eventDecoders[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", t)
+	}
+	return decode(payload)
+}
+
+func decodeEvent[E Event](payload []byte) (Event, error) {
+	var e E
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// OutboxEvent is an event in the outbox waiting to be dispatched.
+type OutboxEvent struct {
+	ID      int64
+	Type    EventType
+	Payload []byte
+	// Attempts counts the failed dispatches so far.
+	Attempts int
+	// Done are the subscribers which handled the event already. They are skipped when it is dispatched again.
+	Done      []string
+	CreatedAt string
+}
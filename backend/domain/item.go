@@ -1,15 +1,21 @@
 package domain
 
+import "time"
+
 type ItemStatus int
 
 const (
 	ItemStatusInitial ItemStatus = iota + 1
 	ItemStatusOnSale
 	ItemStatusSoldOut
+	// ItemStatusModerated is set when an admin takes the item down.
+	ItemStatusModerated
+	// ItemStatusHidden is set when an item on sale collects too many reports. It stays hidden until an admin reviews it.
+	ItemStatusHidden
 )
 
 type Item struct {
-	ID          int32
+	ID          int64
 	Name        string
 	Price       int64
 	Description string
@@ -21,7 +27,33 @@ type Item struct {
 	UpdatedAt   string
 }
 
+// ItemFilter narrows down a list of items. Zero values except Status don't filter.
+type ItemFilter struct {
+	// Status is required.
+	Status ItemStatus
+	// CategoryIDs matches the items in any of the categories or their descendants.
+	CategoryIDs  []int64
+	MinPrice     *int64
+	MaxPrice     *int64
+	SellerID     int64
+	CreatedAfter time.Time
+}
+
 type Category struct {
 	ID   int64
 	Name string
+	// ParentID is 0 for a root category.
+	ParentID int64
+}
+
+// SearchQuery is a query which found items and how often it was searched.
+type SearchQuery struct {
+	Query string
+	Count int64
+}
+
+// LikedItem is an item bookmarked by a user. The Image is not loaded.
+type LikedItem struct {
+	Item
+	LikedAt string
 }
@@ -0,0 +1,68 @@
+package domain
+
+type NotificationKind string
+
+const (
+	// NotificationKindSavedSearch tells that an item matching a saved search was put on sale.
+	NotificationKindSavedSearch NotificationKind = "saved_search"
+	// NotificationKindItemSold tells the seller that an item was purchased.
+	NotificationKindItemSold NotificationKind = "item_sold"
+	// NotificationKindBalanceChanged tells that the balance was topped up or adjusted by an admin.
+	NotificationKindBalanceChanged NotificationKind = "balance_changed"
+	// NotificationKindLikedItemSold tells that an item the user likes was purchased by someone else.
+	NotificationKindLikedItemSold NotificationKind = "liked_item_sold"
+)
+
+// NotificationKinds are all the kinds, in the order they are listed to users.
+var NotificationKinds = []NotificationKind{
+	NotificationKindSavedSearch, NotificationKindItemSold, NotificationKindLikedItemSold, NotificationKindBalanceChanged,
+}
+
+func (k NotificationKind) Valid() bool {
+	for _, kind := range NotificationKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is a message in the inbox of a user.
+type Notification struct {
+	ID     int64
+	UserID int64
+	Kind   NotificationKind
+	// ItemID is the item the notification is about, 0 when there is none.
+	ItemID    int64
+	Message   string
+	CreatedAt string
+	// ReadAt is empty while the notification is unread.
+	ReadAt string
+}
+
+// NotificationPreference is how a user wants to get a kind of notification.
+type NotificationPreference struct {
+	UserID int64
+	Kind   NotificationKind
+	Inbox  bool
+	// Email is only delivered to users who have an email address.
+	Email bool
+}
+
+// DefaultNotificationPreference is used until the user changes the preference of the kind.
+func DefaultNotificationPreference(userID int64, kind NotificationKind) NotificationPreference {
+	return NotificationPreference{UserID: userID, Kind: kind, Inbox: true}
+}
+
+// SavedSearch is a query and a filter of items on sale a user wants to be notified about.
+type SavedSearch struct {
+	ID     int64
+	UserID int64
+	// Query matches the name or the description of items like GET /search. Empty matches any item.
+	Query string
+	// CategoryIDs matches the items in any of the categories or their descendants. Empty matches any category.
+	CategoryIDs []int64
+	MinPrice    *int64
+	MaxPrice    *int64
+	CreatedAt   string
+}
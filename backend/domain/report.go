@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+type ReportReason string
+
+const (
+	ReportReasonFraud         ReportReason = "fraud"
+	ReportReasonCounterfeit   ReportReason = "counterfeit"
+	ReportReasonProhibited    ReportReason = "prohibited"
+	ReportReasonInappropriate ReportReason = "inappropriate"
+	ReportReasonOther         ReportReason = "other"
+)
+
+func (r ReportReason) Valid() bool {
+	switch r {
+	case ReportReasonFraud, ReportReasonCounterfeit, ReportReasonProhibited, ReportReasonInappropriate, ReportReasonOther:
+		return true
+	}
+	return false
+}
+
+// Report is a complaint about an item filed by a user.
+type Report struct {
+	ID         int64
+	ItemID     int64
+	ReporterID int64
+	Reason     ReportReason
+	Comment    string
+	CreatedAt  string
+}
+
+// ReportLimits bound the reports. A user files at most PerReporter reports within Window,
+// and an item reported by HideThreshold distinct users since it was last reviewed is hidden.
+type ReportLimits struct {
+	PerReporter   int64
+	Window        time.Duration
+	HideThreshold int64
+}
+
+// FlaggedItem is an item under moderation with the number of users who reported it since it was last reviewed.
+type FlaggedItem struct {
+	Item
+	ReportCount int64
+}
@@ -1,8 +1,37 @@
 package domain
 
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
 type User struct {
-	ID       int64
-	Password string
-	Name     string
-	Balance  int64
+	ID int64
+	// Password is the bcrypt hash. It must never leave the backend.
+	Password  string `json:"-"`
+	Name      string
+	Email     string
+	Balance   int64
+	Role      Role
+	Suspended bool
+	Bio       string
+	Avatar    []byte `json:"-"`
+	// AvatarType is the MIME type of Avatar, detected from its content.
+	AvatarType string
+	CreatedAt  string
+}
+
+// UserProfile is the public view of a user.
+type UserProfile struct {
+	ID           int64
+	Name         string
+	Bio          string
+	HasAvatar    bool
+	CreatedAt    string
+	ListingCount int64
+	SoldCount    int64
+	// Rating is nil while the user has no ratings. Ratings are not collected yet.
+	Rating *float64
 }
@@ -0,0 +1,42 @@
+package domain
+
+// Webhook is an endpoint of a partner which is sent the events of EventTypes.
+type Webhook struct {
+	ID     int64
+	UserID int64
+	URL    string
+	// EventTypes are the types of the events sent to the endpoint.
+	EventTypes []EventType
+	// Secret is the key of the HMAC signature of the requests.
+	Secret    string
+	CreatedAt string
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookDeliveryStatusDead is the dead letter state of a delivery whose attempts ran out.
+	// It is sent again only when it is redelivered by hand.
+	WebhookDeliveryStatusDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDelivery is an event to be sent to a webhook and the result of the last attempt.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	EventType EventType
+	// Payload is the request body, the same in every attempt.
+	Payload  []byte
+	Status   WebhookDeliveryStatus
+	Attempts int
+	// ResponseStatus is the status code of the last response, 0 when there was none.
+	ResponseStatus int
+	LastError      string
+	// NextAttemptAt is when a pending delivery is sent next.
+	NextAttemptAt string
+	// DeliveredAt is empty until the endpoint accepted the delivery.
+	DeliveredAt string
+	CreatedAt   string
+}
@@ -0,0 +1,155 @@
+// Package events dispatches the domain events in the outbox to the subscribers in the process.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	batchSize = 100
+	// pollInterval is how often the outbox is checked without a commit, which makes the retries run.
+	pollInterval = time.Second
+	// a failed event is dispatched again after baseBackoff, doubling up to maxBackoff, and given up after maxAttempts
+	baseBackoff = time.Second
+	maxBackoff  = 5 * time.Minute
+	maxAttempts = 10
+	// retention is how long dispatched events stay in the outbox.
+	retention = 24 * time.Hour
+)
+
+// Handler handles an event. An error makes the event be dispatched to the handler again later.
+type Handler func(ctx context.Context, e domain.Event) error
+
+type subscriber struct {
+	name   string
+	handle Handler
+}
+
+// Bus delivers the events to the subscribers at least once: a subscriber may see an event again,
+// e.g. when the process stopped before the dispatch was recorded, so handlers should tolerate duplicates.
+// Events are dispatched in the order they were raised, except that a failed event is retried after the ones behind it.
+type Bus struct {
+	repo db.OutboxRepository
+	// written is signaled when events were committed, so that they are dispatched without waiting for the poll
+	written     <-chan struct{}
+	subscribers map[domain.EventType][]subscriber
+}
+
+func NewBus(repo db.OutboxRepository, written <-chan struct{}) *Bus {
+	return &Bus{repo: repo, written: written, subscribers: map[domain.EventType][]subscriber{}}
+}
+
+// Subscribe registers h for the events of type t. It must be called before Run.
+// The name identifies the subscriber in the outbox, where the subscribers which handled an event are recorded,
+// so it has to be unique for the type and stay the same across restarts.
+func (b *Bus) Subscribe(t domain.EventType, name string, h Handler) {
+	for _, s := range b.subscribers[t] {
+		if s.name == name {
+			panic(fmt.Sprintf("events: %s is subscribed to %s twice", name, t))
+		}
+	}
+	b.subscribers[t] = append(b.subscribers[t], subscriber{name: name, handle: h})
+}
+
+// Run dispatches the events until ctx is done. The events left are dispatched after the next start.
+func (b *Bus) Run(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		b.dispatchPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.written:
+		case <-poll.C:
+		case <-cleanup.C:
+			if _, err := b.repo.DeleteDispatchedEvents(ctx, time.Now().Add(-retention)); err != nil {
+				log.Printf("failed to delete dispatched events: %s", err)
+			}
+		}
+	}
+}
+
+// dispatchPending dispatches the events which are due, until there are none or ctx is done.
+func (b *Bus) dispatchPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		// the handlers and the bookkeeping of an event which was started are not canceled, so that it is recorded
+		pending, err := b.repo.GetPendingEvents(context.Background(), time.Now(), batchSize)
+		if err != nil {
+			log.Printf("failed to get pending events: %s", err)
+			return
+		}
+		for _, e := range pending {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := b.dispatch(context.Background(), e); err != nil {
+				log.Printf("failed to record the dispatch of event %d: %s", e.ID, err)
+				return
+			}
+		}
+		if len(pending) < batchSize {
+			return
+		}
+	}
+}
+
+// dispatch hands the event to the subscribers which didn't handle it yet and records the result.
+func (b *Bus) dispatch(ctx context.Context, e domain.OutboxEvent) error {
+	event, err := domain.DecodeEvent(e.Type, e.Payload)
+	if err != nil {
+		// it won't decode next time either
+		log.Printf("giving up event %d: %s", e.ID, err)
+		return b.repo.FailEvent(ctx, e.ID, e.Done, time.Now(), err.Error())
+	}
+
+	done := e.Done
+	handled := make(map[string]bool, len(done))
+	for _, name := range done {
+		handled[name] = true
+	}
+	var errs []string
+	for _, s := range b.subscribers[e.Type] {
+		if handled[s.name] {
+			continue
+		}
+		if err := s.handle(ctx, event); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", s.name, err))
+			continue
+		}
+		done = append(done, s.name)
+	}
+	if len(errs) == 0 {
+		return b.repo.MarkEventDispatched(ctx, e.ID, time.Now())
+	}
+
+	lastError := strings.Join(errs, "; ")
+	attempts := e.Attempts + 1
+	if attempts >= maxAttempts {
+		log.Printf("giving up event %d after %d attempts: %s", e.ID, attempts, lastError)
+		return b.repo.FailEvent(ctx, e.ID, done, time.Now(), lastError)
+	}
+	return b.repo.RetryEvent(ctx, e.ID, done, time.Now().Add(backoff(attempts)), lastError)
+}
+
+// backoff is the delay before the next attempt after the failed attempts.
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// fakeOutbox keeps the events in memory. The methods it doesn't override panic.
+type fakeOutbox struct {
+	db.OutboxRepository
+
+	mu     sync.Mutex
+	events []*fakeEvent
+}
+
+type fakeEvent struct {
+	domain.OutboxEvent
+	next       time.Time
+	dispatched bool
+	failed     bool
+	lastError  string
+}
+
+func (r *fakeOutbox) add(t *testing.T, e domain.Event) int64 {
+	t.Helper()
+	payload, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.addRaw(e.EventType(), payload)
+}
+
+func (r *fakeOutbox) addRaw(t domain.EventType, payload []byte) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := int64(len(r.events) + 1)
+	r.events = append(r.events, &fakeEvent{OutboxEvent: domain.OutboxEvent{ID: id, Type: t, Payload: payload}, next: time.Now()})
+	return id
+}
+
+func (r *fakeOutbox) GetPendingEvents(ctx context.Context, now time.Time, limit int) ([]domain.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []domain.OutboxEvent
+	for _, e := range r.events {
+		if !e.dispatched && !e.failed && !e.next.After(now) && len(res) < limit {
+			res = append(res, e.OutboxEvent)
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeOutbox) MarkEventDispatched(ctx context.Context, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].dispatched = true
+	return nil
+}
+
+func (r *fakeOutbox) RetryEvent(ctx context.Context, id int64, done []string, next time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.events[id-1]
+	e.Attempts, e.Done, e.next, e.lastError = e.Attempts+1, done, next, lastError
+	return nil
+}
+
+func (r *fakeOutbox) FailEvent(ctx context.Context, id int64, done []string, at time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.events[id-1]
+	e.Attempts, e.Done, e.failed, e.lastError = e.Attempts+1, done, true, lastError
+	return nil
+}
+
+func (r *fakeOutbox) event(id int64) fakeEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.events[id-1]
+}
+
+// makeDue moves the next attempt of the event to now instead of waiting for the backoff.
+func (r *fakeOutbox) makeDue(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].next = time.Now()
+}
+
+var topUp = domain.BalanceToppedUp{UserID: 1, Amount: 100, Balance: 100}
+
+func TestBusRetry(t *testing.T) {
+	ctx := context.Background()
+	outbox := &fakeOutbox{}
+	bus := NewBus(outbox, nil)
+
+	calls := map[string]int{}
+	failing := true
+	bus.Subscribe(topUp.EventType(), "ok", func(ctx context.Context, e domain.Event) error {
+		calls["ok"]++
+		if e.(domain.BalanceToppedUp) != topUp {
+			t.Errorf("event = %+v, want %+v", e, topUp)
+		}
+		return nil
+	})
+	bus.Subscribe(topUp.EventType(), "flaky", func(ctx context.Context, e domain.Event) error {
+		calls["flaky"]++
+		if failing {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	id := outbox.add(t, topUp)
+
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		before := time.Now()
+		bus.dispatchPending(ctx)
+		e := outbox.event(id)
+		if e.dispatched || e.failed || e.Attempts != attempt+1 || e.lastError != "flaky: unavailable" {
+			t.Fatalf("event after attempt %d = %+v", attempt+1, e)
+		}
+		if delay := e.next.Sub(before); delay < want || delay > want+time.Second {
+			t.Errorf("next attempt %s after attempt %d, want %s", delay, attempt+1, want)
+		}
+
+		// not dispatched again before the backoff
+		bus.dispatchPending(ctx)
+		if calls["flaky"] != attempt+1 {
+			t.Fatalf("flaky was called %d times during the backoff", calls["flaky"])
+		}
+		outbox.makeDue(id)
+	}
+
+	failing = false
+	bus.dispatchPending(ctx)
+	if e := outbox.event(id); !e.dispatched {
+		t.Fatalf("event after the subscribers succeeded = %+v", e)
+	}
+	// the subscriber which succeeded the first time isn't called again
+	if calls["ok"] != 1 || calls["flaky"] != 4 {
+		t.Errorf("calls = %v, want ok once and flaky 4 times", calls)
+	}
+}
+
+func TestBusGiveUp(t *testing.T) {
+	ctx := context.Background()
+	outbox := &fakeOutbox{}
+	bus := NewBus(outbox, nil)
+
+	calls := 0
+	bus.Subscribe(topUp.EventType(), "broken", func(ctx context.Context, e domain.Event) error {
+		calls++
+		return errors.New("broken")
+	})
+	id := outbox.add(t, topUp)
+	for i := 0; i < maxAttempts; i++ {
+		bus.dispatchPending(ctx)
+		outbox.makeDue(id)
+	}
+	if e := outbox.event(id); !e.failed || e.Attempts != maxAttempts {
+		t.Fatalf("event after %d failed attempts = %+v", maxAttempts, e)
+	}
+	bus.dispatchPending(ctx)
+	if calls != maxAttempts {
+		t.Errorf("the handler was called %d times, want %d", calls, maxAttempts)
+	}
+
+	// an event which doesn't decode is given up right away
+	bad := outbox.addRaw(topUp.EventType(), []byte("{"))
+	bus.dispatchPending(ctx)
+	if e := outbox.event(bad); !e.failed || e.Attempts != 1 {
+		t.Errorf("undecodable event = %+v", e)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 20: maxBackoff} {
+		if got := backoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// EventSource can't set headers, so the token is taken from the query
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/events?token="+alice, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events?token=: status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// the stream was subscribed before the headers were sent
+	s.mustDo(http.MethodPost, "/balance", alice, map[string]int64{"balance": 100}, nil)
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() && lines.Text() != "event: balance" {
+	}
+	if !lines.Scan() || lines.Text() != `data: {"balance":100}` {
+		t.Errorf("balance event: %q, %v", lines.Text(), lines.Err())
+	}
+
+	if status := s.do(http.MethodGet, "/events", "", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("GET /events without a token: status %d, want 401", status)
+	}
+}
+
+func TestTokenFromQueryOnlyForEvents(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+
+	// a token in the query ends up in access logs and browser histories, so the other routes don't take it
+	for _, path := range []string{"/balance", "/notifications"} {
+		if status := s.do(http.MethodGet, path+"?token="+alice, "", nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("GET %s?token=: status %d, want 401", path, status)
+		}
+	}
+	// the header wins over the query on the events route as well
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/events?token=not-a-jwt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+alice)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("GET /events with the token in the header and a bad one in the query: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/policy"
+)
+
+type adminActionRequest struct {
+	Reason string `json:"reason"`
+}
+
+type adjustBalanceRequest struct {
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+type adjustBalanceResponse struct {
+	Balance int64 `json:"balance"`
+}
+
+type flaggedItemResponse struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	UserID      int64             `json:"user_id"`
+	Status      domain.ItemStatus `json:"status"`
+	ReportCount int64             `json:"report_count"`
+}
+
+type flaggedUserResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type getFlagsResponse struct {
+	Items []flaggedItemResponse `json:"items"`
+	Users []flaggedUserResponse `json:"users"`
+}
+
+type auditLogResponse struct {
+	ID         int64              `json:"id"`
+	AdminID    int64              `json:"admin_id"`
+	Action     domain.AuditAction `json:"action"`
+	TargetType string             `json:"target_type"`
+	TargetID   int64              `json:"target_id"`
+	Amount     int64              `json:"amount,omitempty"`
+	Reason     string             `json:"reason"`
+	CreatedAt  string             `json:"created_at"`
+}
+
+// AdminOnly rejects requests from users who aren't admins. It has to run after RejectSuspended, which reads the role.
+func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		subject, err := getSubject(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, err)
+		}
+		if err := policy.CanAdminister(subject); err != nil {
+			return err
+		}
+		return next(c)
+	}
+}
+
+// RejectSuspended rejects requests from suspended users even if they still hold a valid token.
+// It sets the subject of the request with the current role of the user for the handlers and AdminOnly.
+func (h *Handler) RejectSuspended(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := getUserID(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, err)
+		}
+		user, err := h.UserRepo.GetUser(c.Request().Context(), userID)
+		if err != nil {
+			return preconditionIfNotFound(err)
+		}
+		if err := policy.CanUseAccount(user); err != nil {
+			return err
+		}
+		c.Set(subjectKey, policy.Subject{UserID: user.ID, Role: user.Role})
+		return next(c)
+	}
+}
+
+func (h *Handler) SuspendUser(c echo.Context) error {
+	return h.setSuspended(c, true)
+}
+
+func (h *Handler) UnsuspendUser(c echo.Context) error {
+	return h.setSuspended(c, false)
+}
+
+func (h *Handler) setSuspended(c echo.Context, suspended bool) error {
+	ctx := c.Request().Context()
+
+	userID, err := pathID(c, "userID")
+	if err != nil {
+		return err
+	}
+
+	req := new(adminActionRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	if adminID == userID {
+		return domain.NewPreconditionFailedError("cannot change own suspension")
+	}
+
+	action := domain.AuditActionSuspendUser
+	if !suspended {
+		action = domain.AuditActionUnsuspendUser
+	}
+	if err := h.UserRepo.SetSuspended(ctx, userID, suspended, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     action,
+		TargetType: "user",
+		TargetID:   userID,
+		Reason:     req.Reason,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) TakeDownItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	req := new(adminActionRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.ItemRepo.Moderate(ctx, itemID, domain.ItemStatusModerated, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionTakeDownItem,
+		TargetType: "item",
+		TargetID:   itemID,
+		Reason:     req.Reason,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) AdjustBalance(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := pathID(c, "userID")
+	if err != nil {
+		return err
+	}
+
+	req := new(adjustBalanceRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if req.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reason is required")
+	}
+	if req.Amount == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "amount must not be zero")
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	// the audit log and BalanceAdjusted are committed with the balance, which is added to in SQL so that concurrent changes aren't lost
+	balance, err := h.UserRepo.AdjustBalance(ctx, userID, req.Amount, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionAdjustBalance,
+		TargetType: "user",
+		TargetID:   userID,
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, adjustBalanceResponse{Balance: balance})
+}
+
+// RestoreItem gives an item which was hidden by reports or taken down back the status it had before, after review.
+func (h *Handler) RestoreItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	req := new(adminActionRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if _, err := h.ItemRepo.GetItem(ctx, itemID); err != nil {
+		return err
+	}
+	if _, err := h.ItemRepo.Restore(ctx, itemID, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionRestoreItem,
+		TargetType: "item",
+		TargetID:   itemID,
+		Reason:     req.Reason,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// GetFlags lists content which is currently under moderation: items hidden by reports,
+// items taken down by admins and suspended users.
+func (h *Handler) GetFlags(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	items, err := h.ReportRepo.GetFlaggedItems(ctx)
+	if err != nil {
+		return err
+	}
+	users, err := h.UserRepo.GetSuspendedUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	res := getFlagsResponse{
+		Items: make([]flaggedItemResponse, len(items)),
+		Users: make([]flaggedUserResponse, len(users)),
+	}
+	for i, item := range items {
+		res.Items[i] = flaggedItemResponse{ID: item.ID, Name: item.Name, UserID: item.UserID, Status: item.Status, ReportCount: item.ReportCount}
+	}
+	for i, user := range users {
+		res.Users[i] = flaggedUserResponse{ID: user.ID, Name: user.Name}
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetAuditLogs(c echo.Context) error {
+	logs, err := h.AuditRepo.GetAuditLogs(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	res := make([]auditLogResponse, len(logs))
+	for i, log := range logs {
+		res[i] = auditLogResponse{
+			ID:         log.ID,
+			AdminID:    log.AdminID,
+			Action:     log.Action,
+			TargetType: log.TargetType,
+			TargetID:   log.TargetID,
+			Amount:     log.Amount,
+			Reason:     log.Reason,
+			CreatedAt:  log.CreatedAt,
+		}
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetCacheStats reports the hits and misses of the item cache.
+func (h *Handler) GetCacheStats(c echo.Context) error {
+	if h.ItemCache == nil {
+		return domain.NewNotFoundError("cache is disabled")
+	}
+	return c.JSON(http.StatusOK, h.ItemCache.Stats())
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+const maxCategoryNameLength = 50
+
+type categoryTreeResponse struct {
+	ID       int64                  `json:"id"`
+	Name     string                 `json:"name"`
+	Children []categoryTreeResponse `json:"children"`
+}
+
+type addCategoryRequest struct {
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"`
+}
+
+type renameCategoryRequest struct {
+	Name string `json:"name"`
+}
+
+type moveCategoryRequest struct {
+	// ParentID 0 moves the category to the root.
+	ParentID int64 `json:"parent_id"`
+}
+
+// GetCategoryTree returns the root categories with their descendants.
+func (h *Handler) GetCategoryTree(c echo.Context) error {
+	cats, err := h.ItemRepo.GetCategories(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	children := map[int64][]domain.Category{}
+	for _, cat := range cats {
+		children[cat.ParentID] = append(children[cat.ParentID], cat)
+	}
+	var build func(parentID int64) []categoryTreeResponse
+	build = func(parentID int64) []categoryTreeResponse {
+		res := make([]categoryTreeResponse, 0, len(children[parentID]))
+		for _, cat := range children[parentID] {
+			res = append(res, categoryTreeResponse{ID: cat.ID, Name: cat.Name, Children: build(cat.ID)})
+		}
+		return res
+	}
+
+	return c.JSON(http.StatusOK, build(0))
+}
+
+// GetCategoryItems lists the items on sale in the category and all of its descendants.
+func (h *Handler) GetCategoryItems(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := pathID(c, "categoryID")
+	if err != nil {
+		return err
+	}
+	if _, err := h.ItemRepo.GetCategory(ctx, categoryID); err != nil {
+		return err
+	}
+
+	items, err := h.ItemRepo.GetOnSaleItemsInCategory(ctx, categoryID)
+	if err != nil {
+		return err
+	}
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(cats))
+	for _, cat := range cats {
+		names[cat.ID] = cat.Name
+	}
+
+	res := make([]getOnSaleItemsResponse, len(items))
+	for i, item := range items {
+		res[i] = getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: names[item.CategoryID]}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) AddCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(addCategoryRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := validateCategoryName(req.Name); err != nil {
+		return err
+	}
+	if err := h.checkParentCategory(c, req.ParentID); err != nil {
+		return err
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	cat, err := h.ItemRepo.AddCategory(ctx, domain.Category{Name: req.Name, ParentID: req.ParentID}, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionCreateCategory,
+		TargetType: "category",
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, getCategoriesResponse{ID: cat.ID, Name: cat.Name, ParentID: cat.ParentID})
+}
+
+func (h *Handler) RenameCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := pathID(c, "categoryID")
+	if err != nil {
+		return err
+	}
+
+	req := new(renameCategoryRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := validateCategoryName(req.Name); err != nil {
+		return err
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.ItemRepo.RenameCategory(ctx, categoryID, req.Name, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionRenameCategory,
+		TargetType: "category",
+		TargetID:   categoryID,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) MoveCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := pathID(c, "categoryID")
+	if err != nil {
+		return err
+	}
+
+	req := new(moveCategoryRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := h.checkParentCategory(c, req.ParentID); err != nil {
+		return err
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.ItemRepo.MoveCategory(ctx, categoryID, req.ParentID, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionMoveCategory,
+		TargetType: "category",
+		TargetID:   categoryID,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// DeleteCategory deletes a category which neither items nor subcategories reference.
+func (h *Handler) DeleteCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := pathID(c, "categoryID")
+	if err != nil {
+		return err
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.ItemRepo.DeleteCategory(ctx, categoryID, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionDeleteCategory,
+		TargetType: "category",
+		TargetID:   categoryID,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// checkParentCategory checks that the parent given in the request body exists. 0 stands for the root.
+func (h *Handler) checkParentCategory(c echo.Context, parentID int64) error {
+	if parentID < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid parent_id")
+	}
+	if parentID == 0 {
+		return nil
+	}
+	if _, err := h.ItemRepo.GetCategory(c.Request().Context(), parentID); err != nil {
+		return preconditionIfNotFound(err)
+	}
+	return nil
+}
+
+func validateCategoryName(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxCategoryNameLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxCategoryNameLength))
+	}
+	return nil
+}
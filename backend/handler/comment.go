@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/policy"
+)
+
+const (
+	maxCommentLength    = 1000
+	defaultCommentLimit = 20
+	maxCommentLimit     = 100
+)
+
+type addCommentRequest struct {
+	Body string `json:"body"`
+}
+
+type commentResponse struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	UserName  string `json:"user_name"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+
+type getCommentsResponse struct {
+	Comments []commentResponse `json:"comments"`
+	// NextCursor is the cursor of the next page, omitted on the last page.
+	NextCursor int64 `json:"next_cursor,omitempty"`
+}
+
+// AddComment posts a public comment on an item on sale, e.g. a question to the seller or the answer.
+func (h *Handler) AddComment(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	req := new(addCommentRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" || utf8.RuneCountInString(body) > maxCommentLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("body must be 1 to %d characters", maxCommentLength))
+	}
+
+	subject, err := getSubject(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	if err := policy.CanComment(subject, item); err != nil {
+		return err
+	}
+
+	user, err := h.UserRepo.GetUser(ctx, subject.UserID)
+	if err != nil {
+		return preconditionIfNotFound(err)
+	}
+
+	comment, err := h.CommentRepo.AddComment(ctx, domain.Comment{ItemID: itemID, UserID: user.ID, Body: body})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, commentResponse{
+		ID:        comment.ID,
+		UserID:    user.ID,
+		UserName:  user.Name,
+		Body:      comment.Body,
+		CreatedAt: comment.CreatedAt,
+	})
+}
+
+// GetComments lists the comments on an item, the oldest first.
+// The next page is requested with the cursor query parameter set to the next_cursor of the response.
+func (h *Handler) GetComments(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+	limit, err := queryLimit(c, defaultCommentLimit, maxCommentLimit)
+	if err != nil {
+		return err
+	}
+	var cursor int64
+	if v := c.QueryParam("cursor"); v != "" {
+		if cursor, err = strconv.ParseInt(v, 10, 64); err != nil || cursor <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid cursor")
+		}
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	if item.Status == domain.ItemStatusModerated {
+		return domain.NewNotFoundError("item not found")
+	}
+
+	// one more tells whether there is a next page
+	comments, err := h.CommentRepo.GetCommentsByItemID(ctx, itemID, cursor, limit+1)
+	if err != nil {
+		return err
+	}
+
+	res := getCommentsResponse{Comments: []commentResponse{}}
+	if len(comments) > limit {
+		comments = comments[:limit]
+		res.NextCursor = comments[limit-1].ID
+	}
+	for _, comment := range comments {
+		res.Comments = append(res.Comments, commentResponse{
+			ID:        comment.ID,
+			UserID:    comment.UserID,
+			UserName:  comment.UserName,
+			Body:      comment.Body,
+			CreatedAt: comment.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteComment lets the seller of the item remove a comment on it, also after the item was sold.
+func (h *Handler) DeleteComment(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+	commentID, err := pathID(c, "commentID")
+	if err != nil {
+		return err
+	}
+
+	subject, err := getSubject(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	if err := policy.CanManageItem(subject, item); err != nil {
+		return err
+	}
+
+	if err := h.CommentRepo.DeleteComment(ctx, commentID, itemID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
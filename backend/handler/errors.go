@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+const mimeApplicationProblemJSON = "application/problem+json"
+
+// problem is the response body defined by RFC 7807.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// HTTPErrorHandler maps errors returned from handlers to problem+json responses.
+// Domain errors keep their message, everything else is reported as an internal server error
+// so that SQL errors etc. are never exposed to clients.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, detail := statusAndDetail(err)
+	if status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	p := problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request().URL.Path,
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		// c.JSON keeps an already set Content-Type
+		c.Response().Header().Set(echo.HeaderContentType, mimeApplicationProblemJSON)
+		err = c.JSON(status, p)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+func statusAndDetail(err error) (int, string) {
+	var (
+		notFound     *domain.NotFoundError
+		conflict     *domain.ConflictError
+		precondition *domain.PreconditionFailedError
+		forbidden    *domain.ForbiddenError
+		tooMany      *domain.TooManyRequestsError
+		httpErr      *echo.HTTPError
+	)
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound, notFound.Error()
+	case errors.As(err, &conflict):
+		return http.StatusConflict, conflict.Error()
+	case errors.As(err, &precondition):
+		return http.StatusPreconditionFailed, precondition.Error()
+	case errors.As(err, &forbidden):
+		return http.StatusForbidden, forbidden.Error()
+	case errors.As(err, &tooMany):
+		return http.StatusTooManyRequests, tooMany.Error()
+	case errors.As(err, &httpErr):
+		return statusAndDetailFromHTTPError(httpErr)
+	default:
+		return http.StatusInternalServerError, ""
+	}
+}
+
+func statusAndDetailFromHTTPError(he *echo.HTTPError) (int, string) {
+	if he.Code >= http.StatusInternalServerError {
+		return he.Code, ""
+	}
+	switch m := he.Message.(type) {
+	case string:
+		return he.Code, m
+	case error:
+		return he.Code, m.Error()
+	case nil:
+		return he.Code, ""
+	default:
+		return he.Code, fmt.Sprint(m)
+	}
+}
+
+// preconditionIfNotFound reports a missing resource as 412 instead of 404.
+// It is used for resources referenced from the request body or the token rather than from the URL.
+func preconditionIfNotFound(err error) error {
+	var notFound *domain.NotFoundError
+	if errors.As(err, &notFound) {
+		return domain.NewPreconditionFailedError(notFound.Message)
+	}
+	return err
+}
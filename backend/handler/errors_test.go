@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantDetail string
+	}{
+		{"not found", domain.NewNotFoundError("item not found"), http.StatusNotFound, "item not found"},
+		{"conflict", domain.NewConflictError("user conflicts with an existing one"), http.StatusConflict, "user conflicts with an existing one"},
+		{"precondition failed", domain.NewPreconditionFailedError("item is not on sale"), http.StatusPreconditionFailed, "item is not on sale"},
+		{"forbidden", domain.NewForbiddenError("admin role is required"), http.StatusForbidden, "admin role is required"},
+		{"too many requests", domain.NewTooManyRequestsError("too many reports"), http.StatusTooManyRequests, "too many reports"},
+		{"wrapped domain error", errors.Wrap(domain.NewNotFoundError("item not found"), "failed to get item"), http.StatusNotFound, "item not found"},
+		{"http error with a string", echo.NewHTTPError(http.StatusBadRequest, "invalid price"), http.StatusBadRequest, "invalid price"},
+		{"http error with an error", echo.NewHTTPError(http.StatusUnauthorized, errors.New("invalid token")), http.StatusUnauthorized, "invalid token"},
+		{"http error without message", &echo.HTTPError{Code: http.StatusMethodNotAllowed}, http.StatusMethodNotAllowed, ""},
+		// the details of server errors are only logged
+		{"http server error", echo.NewHTTPError(http.StatusServiceUnavailable, "db is locked"), http.StatusServiceUnavailable, ""},
+		{"other error", errors.New("no such table: items"), http.StatusInternalServerError, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+			rec := httptest.NewRecorder()
+			HTTPErrorHandler(tt.err, echo.New().NewContext(req, rec))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get(echo.HeaderContentType); got != mimeApplicationProblemJSON {
+				t.Errorf("Content-Type = %q, want %s", got, mimeApplicationProblemJSON)
+			}
+			var p problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			want := problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.wantStatus),
+				Status:   tt.wantStatus,
+				Detail:   tt.wantDetail,
+				Instance: "/items/1",
+			}
+			if p != want {
+				t.Errorf("body = %+v, want %+v", p, want)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorHandlerHead(t *testing.T) {
+	req := httptest.NewRequest(http.MethodHead, "/items/1", nil)
+	rec := httptest.NewRecorder()
+	HTTPErrorHandler(domain.NewNotFoundError("item not found"), echo.New().NewContext(req, rec))
+
+	if rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Errorf("HEAD: status %d with %d bytes of body, want 404 without body", rec.Code, rec.Body.Len())
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// eventsKeepAlive is the interval of the comments sent on an idle stream, so that proxies don't close it.
+const eventsKeepAlive = 30 * time.Second
+
+// Events streams the events of the user and the events for everyone as Server-Sent Events.
+// Each event has the type of the realtime.Event as its name and the data as JSON.
+// The stream ends when the client goes away, when it falls behind, or on shutdown; clients reconnect and reload the state.
+func (h *Handler) Events(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	sub := h.Hub.Subscribe(userID)
+	defer sub.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses by default
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case e, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+// TokenFromQuery moves the token query parameter into the Authorization header for clients which can't set headers,
+// such as EventSource. It has to run before the JWT middleware.
+// The request is changed in place, so that the token is not written to the access log either.
+func TokenFromQuery(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		q := req.URL.Query()
+		if token := q.Get("token"); token != "" {
+			if req.Header.Get(echo.HeaderAuthorization) == "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			}
+			q.Del("token")
+			req.URL.RawQuery = q.Encode()
+			req.RequestURI = req.URL.RequestURI()
+		}
+		return next(c)
+	}
+}
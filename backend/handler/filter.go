@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/policy"
+)
+
+// priceBuckets are the lower bounds of the price facets. The last bucket has no upper bound.
+var priceBuckets = []int64{0, 1000, 3000, 5000, 10000, 30000}
+
+type categoryFacetResponse struct {
+	CategoryID   int64  `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	Count        int    `json:"count"`
+}
+
+type priceFacetResponse struct {
+	Min int64 `json:"min"`
+	// Max is exclusive and omitted for the last bucket.
+	Max   int64 `json:"max,omitempty"`
+	Count int   `json:"count"`
+}
+
+type itemFacetsResponse struct {
+	Categories []categoryFacetResponse `json:"categories"`
+	Prices     []priceFacetResponse    `json:"prices"`
+}
+
+type getItemsWithFacetsResponse struct {
+	Items  []getOnSaleItemsResponse `json:"items"`
+	Facets itemFacetsResponse       `json:"facets"`
+}
+
+// itemFilter reads the filter of GET /items from the query parameters:
+//
+//	category_id    repeated or comma separated, includes the descendants of the categories
+//	min_price      inclusive
+//	max_price      inclusive
+//	seller_id
+//	status         2 (on sale, the default) or 3 (sold out)
+//	created_after  RFC 3339 or YYYY-MM-DD
+func itemFilter(c echo.Context) (domain.ItemFilter, error) {
+	filter := domain.ItemFilter{Status: domain.ItemStatusOnSale}
+
+	for _, param := range c.QueryParams()["category_id"] {
+		for _, v := range strings.Split(param, ",") {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid category_id")
+			}
+			filter.CategoryIDs = append(filter.CategoryIDs, id)
+		}
+	}
+
+	var err error
+	if filter.MinPrice, err = queryPrice(c, "min_price"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = queryPrice(c, "max_price"); err != nil {
+		return filter, err
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, echo.NewHTTPError(http.StatusBadRequest, "min_price must not be greater than max_price")
+	}
+
+	if v := c.QueryParam("seller_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid seller_id")
+		}
+		filter.SellerID = id
+	}
+
+	if v := c.QueryParam("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		// drafts and items under moderation are never listed here
+		if err != nil || !policy.PublicStatus(domain.ItemStatus(status)) {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+		}
+		filter.Status = domain.ItemStatus(status)
+	}
+
+	if v := c.QueryParam("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02", v, time.Local)
+		}
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid created_after")
+		}
+		filter.CreatedAfter = t
+	}
+
+	return filter, nil
+}
+
+func queryPrice(c echo.Context, name string) (*int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	price, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || price < 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s", name))
+	}
+	return &price, nil
+}
+
+// itemFacets counts the items per category and per price bucket.
+// Categories without items are left out and the others are sorted by count, while every price bucket is present.
+func itemFacets(items []domain.Item, categoryNames map[int64]string) itemFacetsResponse {
+	res := itemFacetsResponse{
+		Categories: []categoryFacetResponse{},
+		Prices:     make([]priceFacetResponse, len(priceBuckets)),
+	}
+	for i, min := range priceBuckets {
+		res.Prices[i].Min = min
+		if i+1 < len(priceBuckets) {
+			res.Prices[i].Max = priceBuckets[i+1]
+		}
+	}
+
+	byCategory := map[int64]int{}
+	for _, item := range items {
+		if _, ok := byCategory[item.CategoryID]; !ok {
+			byCategory[item.CategoryID] = len(res.Categories)
+			res.Categories = append(res.Categories, categoryFacetResponse{CategoryID: item.CategoryID, CategoryName: categoryNames[item.CategoryID]})
+		}
+		res.Categories[byCategory[item.CategoryID]].Count++
+
+		for i := len(priceBuckets) - 1; i >= 0; i-- {
+			if item.Price >= priceBuckets[i] {
+				res.Prices[i].Count++
+				break
+			}
+		}
+	}
+	sort.SliceStable(res.Categories, func(i, j int) bool { return res.Categories[i].Count > res.Categories[j].Count })
+	return res
+}
@@ -2,28 +2,40 @@ package handler
 
 import (
 	"bytes"
-	"database/sql"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/cache"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
 	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
 	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/mail"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/notification"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/policy"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/realtime"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/search"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/throttle"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/webhook"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/worker"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var (
-	logFile = getEnv("LOGFILE", "access.log")
-)
+// dummyPasswordHash is compared with the password of a login to a missing user. It has the cost of the passwords
+// of the users and no known password.
+var dummyPasswordHash = []byte("$2a$10$mrg7hhPP3zwVByU85tTXKuvhtpY0bM/.lKxKTE3d3J1yFR7UMqa/S")
 
 type JwtCustomClaims struct {
 	UserID int64 `json:"user_id"`
+	// Role is for the frontend. The server reads the role from the user row, see getSubject.
+	Role domain.Role `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -34,6 +46,7 @@ type InitializeResponse struct {
 type registerRequest struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
+	Email    string `json:"email"`
 }
 
 type registerResponse struct {
@@ -42,21 +55,21 @@ type registerResponse struct {
 }
 
 type getUserItemsResponse struct {
-	ID           int32  `json:"id"`
+	ID           int64  `json:"id"`
 	Name         string `json:"name"`
 	Price        int64  `json:"price"`
 	CategoryName string `json:"category_name"`
 }
 
 type getOnSaleItemsResponse struct {
-	ID           int32  `json:"id"`
+	ID           int64  `json:"id"`
 	Name         string `json:"name"`
 	Price        int64  `json:"price"`
 	CategoryName string `json:"category_name"`
 }
 
 type getItemResponse struct {
-	ID           int32             `json:"id"`
+	ID           int64             `json:"id"`
 	Name         string            `json:"name"`
 	CategoryID   int64             `json:"category_id"`
 	CategoryName string            `json:"category_name"`
@@ -64,15 +77,19 @@ type getItemResponse struct {
 	Price        int64             `json:"price"`
 	Description  string            `json:"description"`
 	Status       domain.ItemStatus `json:"status"`
+	LikeCount    int64             `json:"like_count"`
+	// LikedByMe is false for anonymous requests.
+	LikedByMe bool `json:"liked_by_me"`
 }
 
 type getCategoriesResponse struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id,omitempty"`
 }
 
 type sellRequest struct {
-	ItemID int32 `json:"item_id"`
+	ItemID int64 `json:"item_id"`
 }
 
 type addItemRequest struct {
@@ -106,34 +123,64 @@ type loginResponse struct {
 }
 
 type Handler struct {
-	DB       *sql.DB
+	Config   *config.Config
+	DB       *db.DB
 	UserRepo db.UserRepository
 	ItemRepo db.ItemRepository
-}
-
-func GetSecret() string {
-	if secret := os.Getenv("SECRET"); secret != "" {
-		return secret
-	}
-	return "secret-key"
+	// ItemCache is the cache in front of ItemRepo, nil when there is none
+	ItemCache  *cache.ItemRepository
+	AuditRepo  db.AuditRepository
+	ReportRepo db.ReportRepository
+	ResetRepo  db.PasswordResetRepository
+	SearchRepo db.SearchRepository
+	// SearchIndex has to be loaded again when the DB is reset
+	SearchIndex *search.Index
+	// Matcher notifies the saved searches of the items put on sale
+	Matcher          *search.Matcher
+	SavedSearchRepo  db.SavedSearchRepository
+	NotificationRepo db.NotificationRepository
+	LikeRepo         db.LikeRepository
+	CommentRepo      db.CommentRepository
+	Notifier         *notification.Service
+	// Hub pushes changes to the clients connected to GET /events
+	Hub         *realtime.Hub
+	WebhookRepo db.WebhookRepository
+	// Webhooks sends the events to the webhooks
+	Webhooks *webhook.Dispatcher
+	Mailer   mail.Mailer
+	// PasswordResets queues the emails which requested a password reset, for RunPasswordResets
+	PasswordResets *worker.Queue[string]
+	// AccountGuard and IPGuard throttle failed logins per user ID and per client IP
+	AccountGuard *throttle.Guard
+	IPGuard      *throttle.Guard
+	// ResetGuard throttles the password reset requests per email
+	ResetGuard *throttle.Guard
+
+	ready atomic.Bool
 }
 
 func (h *Handler) Initialize(c echo.Context) error {
-	err := os.Truncate(logFile, 0)
+	err := os.Truncate(h.Config.Server.AccessLogFile, 0)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to truncate access log"))
 	}
 
-	err = db.Initialize(c.Request().Context(), h.DB)
+	err = db.Initialize(c.Request().Context(), h.DB.Write, h.Config.DB.SQLDir)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to initialize"))
 	}
+	if h.ItemCache != nil {
+		h.ItemCache.Purge()
+	}
+	if err := h.SearchIndex.Load(c.Request().Context(), h.SearchRepo); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to load search index"))
+	}
 
 	return c.JSON(http.StatusOK, InitializeResponse{Message: "Success"})
 }
 
 func (h *Handler) AccessLog(c echo.Context) error {
-	return c.File(logFile)
+	return c.File(h.Config.Server.AccessLogFile)
 }
 
 func (h *Handler) Register(c echo.Context) error {
@@ -143,15 +190,18 @@ func (h *Handler) Register(c echo.Context) error {
 	if err := c.Bind(req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
+	if req.Email != "" && !validEmail(req.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid email")
+	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	userID, err := h.UserRepo.AddUser(c.Request().Context(), domain.User{Name: req.Name, Password: string(hash)})
+	userID, err := h.UserRepo.AddUser(c.Request().Context(), domain.User{Name: req.Name, Password: string(hash), Email: req.Email})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
 	return c.JSON(http.StatusOK, registerResponse{ID: userID, Name: req.Name})
@@ -166,29 +216,50 @@ func (h *Handler) Login(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
+	// Reserve the attempt before bcrypt so that guessing can't burn CPU. It counts as failed until the password matched.
+	accountKey, ipKey := strconv.FormatInt(req.UserID, 10), c.RealIP()
+	if err := h.reserveLogin(c, accountKey, ipKey); err != nil {
+		return err
+	}
+
 	user, err := h.UserRepo.GetUser(ctx, req.UserID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		var notFound *domain.NotFoundError
+		if errors.As(err, &notFound) {
+			// compare anyway so that the response time doesn't tell whether the user exists
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid user id or password")
+		}
+		return err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
 		if err == bcrypt.ErrMismatchedHashAndPassword {
-			return echo.NewHTTPError(http.StatusUnauthorized, err)
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid user id or password")
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	if err := h.loginSucceeded(c, accountKey, ipKey); err != nil {
+		return err
+	}
+
+	if err := policy.CanUseAccount(user); err != nil {
+		return err
+	}
+
 	// Set custom claims
 	claims := &JwtCustomClaims{
 		req.UserID,
+		user.Role,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.Config.Auth.TokenTTL)),
 		},
 	}
 	// Create token with claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// Generate encoded token and send it as response.
-	encodedToken, err := token.SignedString([]byte(GetSecret()))
+	encodedToken, err := token.SignedString([]byte(h.Config.Auth.Secret))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
@@ -216,7 +287,7 @@ func (h *Handler) AddItem(c echo.Context) error {
 	}
 	file, err := c.FormFile("image")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusBadRequest, "image is required")
 	}
 
 	src, err := file.Open()
@@ -235,10 +306,11 @@ func (h *Handler) AddItem(c echo.Context) error {
 
 	_, err = h.ItemRepo.GetCategory(ctx, req.CategoryID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		var notFound *domain.NotFoundError
+		if errors.As(err, &notFound) {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID")
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
 	item, err := h.ItemRepo.AddItem(c.Request().Context(), domain.Item{
@@ -251,10 +323,10 @@ func (h *Handler) AddItem(c echo.Context) error {
 		Status:      domain.ItemStatusInitial,
 	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	return c.JSON(http.StatusOK, addItemResponse{ID: int64(item.ID)})
+	return c.JSON(http.StatusOK, addItemResponse{ID: item.ID})
 }
 
 func (h *Handler) Sell(c echo.Context) error {
@@ -265,68 +337,92 @@ func (h *Handler) Sell(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
+	subject, err := getSubject(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
 	item, err := h.ItemRepo.GetItem(ctx, req.ItemID)
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return preconditionIfNotFound(err)
 	}
 
-	// TODO: check req.UserID and item.UserID
-	// http.StatusPreconditionFailed(412)
-	// TODO: only update when status is initial
-	// http.StatusPreconditionFailed(412)
-	if err := h.ItemRepo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusOnSale); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err := policy.CanSell(subject, item); err != nil {
+		return err
+	}
+	if err := h.ItemRepo.ListItem(ctx, item.ID); err != nil {
+		return preconditionIfNotFound(err)
 	}
 
 	return c.JSON(http.StatusOK, "successful")
 }
 
+// GetOnSaleItems lists the items on sale, narrowed down by the query parameters (see itemFilter).
+// With facets=true the items are wrapped in an object together with their facet counts.
 func (h *Handler) GetOnSaleItems(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	items, err := h.ItemRepo.GetOnSaleItems(ctx)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	filter, err := itemFilter(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+	items, err := h.ItemRepo.GetItems(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(cats))
+	for _, cat := range cats {
+		names[cat.ID] = cat.Name
 	}
 
 	var res []getOnSaleItemsResponse
 	for _, item := range items {
-		cats, err := h.ItemRepo.GetCategories(ctx)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
-		}
-		for _, cat := range cats {
-			if cat.ID == item.CategoryID {
-				res = append(res, getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: cat.Name})
-			}
+		if name, ok := names[item.CategoryID]; ok {
+			res = append(res, getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: name})
 		}
 	}
 
+	if facets, _ := strconv.ParseBool(c.QueryParam("facets")); facets {
+		return c.JSON(http.StatusOK, getItemsWithFacetsResponse{Items: res, Facets: itemFacets(items, names)})
+	}
 	return c.JSON(http.StatusOK, res)
 }
 
 func (h *Handler) GetItem(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	itemID, err := strconv.Atoi(c.Param("itemID"))
+	itemID, err := pathID(c, "itemID")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+	if item.Status == domain.ItemStatusModerated {
+		return domain.NewNotFoundError("item not found")
 	}
 
 	category, err := h.ItemRepo.GetCategory(ctx, item.CategoryID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+	likes, err := h.LikeRepo.CountLikes(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+	var liked bool
+	// the route takes a token optionally
+	if subject, err := getSubject(c); err == nil {
+		if liked, err = h.LikeRepo.IsLiked(ctx, subject.UserID, item.ID); err != nil {
+			return err
+		}
 	}
 	return c.JSON(http.StatusOK, getItemResponse{
 		ID:           item.ID,
@@ -337,29 +433,42 @@ func (h *Handler) GetItem(c echo.Context) error {
 		Price:        item.Price,
 		Description:  item.Description,
 		Status:       item.Status,
+		LikeCount:    likes,
+		LikedByMe:    liked,
 	})
 }
 
 func (h *Handler) GetUserItems(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	userID, err := pathID(c, "userID")
+	if err != nil {
+		return err
+	}
+
+	subject, err := getSubject(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid userID type")
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	view := policy.UserItemsView(subject, userID)
+
+	if _, err := h.UserRepo.GetUser(ctx, userID); err != nil {
+		return err
 	}
 
 	items, err := h.ItemRepo.GetItemsByUserID(ctx, userID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
 	var res []getUserItemsResponse
 	for _, item := range items {
+		if !view.Visible(item) {
+			continue
+		}
 		cats, err := h.ItemRepo.GetCategories(ctx)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
+			return err
 		}
 		for _, cat := range cats {
 			if cat.ID == item.CategoryID {
@@ -375,15 +484,13 @@ func (h *Handler) GetCategories(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	cats, err := h.ItemRepo.GetCategories(ctx)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
 	res := make([]getCategoriesResponse, len(cats))
 	for i, cat := range cats {
-		res[i] = getCategoriesResponse{ID: cat.ID, Name: cat.Name}
+		res[i] = getCategoriesResponse{ID: cat.ID, Name: cat.Name, ParentID: cat.ParentID}
 	}
 
 	return c.JSON(http.StatusOK, res)
@@ -392,16 +499,14 @@ func (h *Handler) GetCategories(c echo.Context) error {
 func (h *Handler) GetImage(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	// TODO: overflow
-	itemID, err := strconv.Atoi(c.Param("itemID"))
+	itemID, err := pathID(c, "itemID")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid itemID type")
+		return err
 	}
 
-	// オーバーフローしていると。ここのint32(itemID)がバグって正常に処理ができないはず
-	data, err := h.ItemRepo.GetItemImage(ctx, int32(itemID))
+	data, err := h.ItemRepo.GetItemImage(ctx, itemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
 	return c.Blob(http.StatusOK, "image/jpeg", data)
@@ -420,15 +525,8 @@ func (h *Handler) AddBalance(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	user, err := h.UserRepo.GetUser(ctx, userID)
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance+req.Balance); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if _, err := h.UserRepo.TopUp(ctx, userID, req.Balance); err != nil {
+		return preconditionIfNotFound(err)
 	}
 
 	return c.JSON(http.StatusOK, "successful")
@@ -443,10 +541,8 @@ func (h *Handler) GetBalance(c echo.Context) error {
 	}
 
 	user, err := h.UserRepo.GetUser(ctx, userID)
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return preconditionIfNotFound(err)
 	}
 
 	return c.JSON(http.StatusOK, getBalanceResponse{Balance: user.Balance})
@@ -455,57 +551,29 @@ func (h *Handler) GetBalance(c echo.Context) error {
 func (h *Handler) Purchase(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	userID, err := getUserID(c)
+	subject, err := getSubject(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
+	userID := subject.UserID
 
-	// TODO: overflow
-	itemID, err := strconv.Atoi(c.Param("itemID"))
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	// TODO: update only when item status is on sale
-	// http.StatusPreconditionFailed(412)
-
-	// オーバーフローしていると。ここのint32(itemID)がバグって正常に処理ができないはず
-	if err := h.ItemRepo.UpdateItemStatus(ctx, int32(itemID), domain.ItemStatusSoldOut); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	user, err := h.UserRepo.GetUser(ctx, userID)
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
+	itemID, err := pathID(c, "itemID")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	// TODO: if it is fail here, item status is still sold
-	// TODO: balance consistency
-	// TODO: not to buy own items. 自身の商品を買おうとしていたら、http.StatusPreconditionFailed(412)
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance-item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return preconditionIfNotFound(err)
 	}
 
-	sellerID := item.UserID
-
-	seller, err := h.UserRepo.GetUser(ctx, sellerID)
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err := policy.CanPurchase(subject, item); err != nil {
+		return err
 	}
 
-	if err := h.UserRepo.UpdateBalance(ctx, sellerID, seller.Balance+item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	// the item, the balances and the ItemSold event are changed at once
+	if err := h.ItemRepo.Purchase(ctx, itemID, userID); err != nil {
+		return preconditionIfNotFound(err)
 	}
 
 	return c.JSON(http.StatusOK, "successful")
@@ -524,10 +592,33 @@ func getUserID(c echo.Context) (int64, error) {
 	return claims.UserID, nil
 }
 
-func getEnv(key string, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// subjectKey is the key of the subject set by RejectSuspended in the echo context.
+const subjectKey = "subject"
+
+// getSubject returns the subject of the request. The role is the one of the user row read by RejectSuspended,
+// so that a demoted admin loses access before the token expires. The role claim of the token is never trusted:
+// without RejectSuspended the subject is a plain user.
+func getSubject(c echo.Context) (policy.Subject, error) {
+	if subject, ok := c.Get(subjectKey).(policy.Subject); ok {
+		return subject, nil
+	}
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok || user == nil {
+		return policy.Subject{}, fmt.Errorf("invalid token")
+	}
+	claims, ok := user.Claims.(*JwtCustomClaims)
+	if !ok || claims == nil {
+		return policy.Subject{}, fmt.Errorf("invalid token")
+	}
+
+	return policy.Subject{UserID: claims.UserID, Role: domain.RoleUser}, nil
+}
+
+// RateLimitKey identifies the logged in user for the rate limiter. It has to run after the JWT middleware.
+func RateLimitKey(c echo.Context) string {
+	subject, err := getSubject(c)
+	if err != nil {
+		return "ip:" + c.RealIP()
 	}
-	return value
+	return "user:" + strconv.FormatInt(subject.UserID, 10)
 }
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A login to a missing user has to take as long as one to an existing user.
+func TestDummyPasswordHash(t *testing.T) {
+	cost, err := bcrypt.Cost(dummyPasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("cost of the dummy hash = %d, want the cost of the user passwords %d", cost, bcrypt.DefaultCost)
+	}
+	if err := bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte("password")); err != bcrypt.ErrMismatchedHashAndPassword {
+		t.Errorf("comparing with the dummy hash: %v, want a mismatch", err)
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// SetReady switches whether /readyz reports the server as ready. It is turned off first when shutting down.
+func (h *Handler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Healthz reports whether the process is alive and can reach the DB.
+func (h *Handler) Healthz(c echo.Context) error {
+	if err := h.pingDB(c.Request().Context()); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusServiceUnavailable, healthResponse{Status: "db unavailable"})
+	}
+	return c.JSON(http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Readyz reports whether the server accepts traffic. It fails while shutting down so that load balancers stop sending requests.
+func (h *Handler) Readyz(c echo.Context) error {
+	if !h.ready.Load() {
+		return c.JSON(http.StatusServiceUnavailable, healthResponse{Status: "not ready"})
+	}
+	return h.Healthz(c)
+}
+
+func (h *Handler) pingDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	return h.DB.PingContext(ctx)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/policy"
+)
+
+type likedItemResponse struct {
+	ID           int64             `json:"id"`
+	Name         string            `json:"name"`
+	Price        int64             `json:"price"`
+	CategoryName string            `json:"category_name"`
+	Status       domain.ItemStatus `json:"status"`
+	LikedAt      string            `json:"liked_at"`
+}
+
+// LikeItem bookmarks the item. The user is notified when it is sold to someone else.
+func (h *Handler) LikeItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	subject, err := getSubject(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	if err := policy.CanLike(subject, item); err != nil {
+		return err
+	}
+
+	if err := h.LikeRepo.AddLike(ctx, subject.UserID, itemID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) UnlikeItem(c echo.Context) error {
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.LikeRepo.DeleteLike(c.Request().Context(), userID, itemID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// GetMyLikes lists the items the user likes, the most recently liked first. Items which were taken down are left out.
+func (h *Handler) GetMyLikes(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	items, err := h.LikeRepo.GetLikedItems(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(cats))
+	for _, cat := range cats {
+		names[cat.ID] = cat.Name
+	}
+
+	res := []likedItemResponse{}
+	for _, item := range items {
+		if !policy.PublicStatus(item.Status) {
+			continue
+		}
+		res = append(res, likedItemResponse{
+			ID:           item.ID,
+			Name:         item.Name,
+			Price:        item.Price,
+			CategoryName: names[item.CategoryID],
+			Status:       item.Status,
+			LikedAt:      item.LikedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reserveLogin counts the attempt as failed for the account and the client IP before the password is checked,
+// and responds 429 with Retry-After while either of them is backing off or locked.
+// Reserving up front keeps parallel guesses from all passing the throttle before the first of them failed.
+func (h *Handler) reserveLogin(c echo.Context, accountKey, ipKey string) error {
+	ctx := c.Request().Context()
+
+	accountWait, err := h.AccountGuard.Reserve(ctx, accountKey)
+	if err != nil {
+		return err
+	}
+	if accountWait > 0 {
+		return tooManyRequests(c, accountWait, "too many failed login attempts")
+	}
+	ipWait, err := h.IPGuard.Reserve(ctx, ipKey)
+	if err != nil {
+		return err
+	}
+	if ipWait > 0 {
+		// the attempt is not made, so the account doesn't keep it
+		if err := h.AccountGuard.Release(ctx, accountKey); err != nil {
+			return err
+		}
+		return tooManyRequests(c, ipWait, "too many failed login attempts")
+	}
+	return nil
+}
+
+// loginSucceeded forgets the failures of the account. The IP only gets its attempt back
+// so that logging in to an own account doesn't reset guessing on others.
+func (h *Handler) loginSucceeded(c echo.Context, accountKey, ipKey string) error {
+	ctx := c.Request().Context()
+
+	if err := h.AccountGuard.Succeed(ctx, accountKey); err != nil {
+		return err
+	}
+	return h.IPGuard.Release(ctx, ipKey)
+}
+
+func tooManyRequests(c echo.Context, retryAfter time.Duration, msg string) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return echo.NewHTTPError(http.StatusTooManyRequests, msg)
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// notificationsLimit is the number of the latest notifications GET /notifications returns.
+const notificationsLimit = 50
+
+type notificationResponse struct {
+	ID        int64                   `json:"id"`
+	Kind      domain.NotificationKind `json:"kind"`
+	ItemID    int64                   `json:"item_id,omitempty"`
+	Message   string                  `json:"message"`
+	Read      bool                    `json:"read"`
+	CreatedAt string                  `json:"created_at"`
+}
+
+type getNotificationsResponse struct {
+	UnreadCount   int64                  `json:"unread_count"`
+	Notifications []notificationResponse `json:"notifications"`
+}
+
+type readNotificationsRequest struct {
+	// IDs are the notifications to mark as read. All of them are marked when it is empty.
+	IDs []int64 `json:"ids"`
+}
+
+type readNotificationsResponse struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+type notificationPreferenceResponse struct {
+	Kind  domain.NotificationKind `json:"kind"`
+	Inbox bool                    `json:"inbox"`
+	Email bool                    `json:"email"`
+}
+
+type notificationPreferenceRequest struct {
+	Kind  domain.NotificationKind `json:"kind"`
+	Inbox bool                    `json:"inbox"`
+	Email bool                    `json:"email"`
+}
+
+// GetNotifications returns the latest notifications of the user, the newest first, and the number of unread ones.
+func (h *Handler) GetNotifications(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	notifications, err := h.NotificationRepo.GetNotificationsByUserID(ctx, userID, notificationsLimit)
+	if err != nil {
+		return err
+	}
+	unread, err := h.NotificationRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	res := getNotificationsResponse{UnreadCount: unread, Notifications: make([]notificationResponse, len(notifications))}
+	for i, n := range notifications {
+		res.Notifications[i] = notificationResponse{
+			ID:        n.ID,
+			Kind:      n.Kind,
+			ItemID:    n.ItemID,
+			Message:   n.Message,
+			Read:      n.ReadAt != "",
+			CreatedAt: n.CreatedAt,
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ReadNotifications(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(readNotificationsRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.NotificationRepo.MarkNotificationsRead(ctx, userID, req.IDs, time.Now()); err != nil {
+		return err
+	}
+	unread, err := h.NotificationRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, readNotificationsResponse{UnreadCount: unread})
+}
+
+// GetNotificationPreferences returns how the user gets each kind of notification.
+func (h *Handler) GetNotificationPreferences(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	return h.notificationPreferences(c, userID)
+}
+
+// UpdateNotificationPreferences changes the preferences of the kinds in the request. The other kinds are kept.
+func (h *Handler) UpdateNotificationPreferences(c echo.Context) error {
+	var req []notificationPreferenceRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	prefs := make([]domain.NotificationPreference, len(req))
+	for i, pref := range req {
+		if !pref.Kind.Valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid kind")
+		}
+		prefs[i] = domain.NotificationPreference{UserID: userID, Kind: pref.Kind, Inbox: pref.Inbox, Email: pref.Email}
+	}
+	if err := h.NotificationRepo.SetNotificationPreferences(c.Request().Context(), prefs); err != nil {
+		return preconditionIfNotFound(err)
+	}
+	return h.notificationPreferences(c, userID)
+}
+
+func (h *Handler) notificationPreferences(c echo.Context, userID int64) error {
+	prefs, err := h.Notifier.Preferences(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	res := make([]notificationPreferenceResponse, len(prefs))
+	for i, pref := range prefs {
+		res[i] = notificationPreferenceResponse{Kind: pref.Kind, Inbox: pref.Inbox, Email: pref.Email}
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pathID parses the path parameter name as a positive int64 ID.
+// Malformed or out of range values are rejected with 400 instead of being wrapped around.
+func pathID(c echo.Context, name string) (int64, error) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s", name))
+	}
+	return id, nil
+}
+
+// queryLimit parses the limit query parameter, which is def when it is absent and at most max.
+func queryLimit(c echo.Context, def, max int) (int, error) {
+	v := c.QueryParam("limit")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > max {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestPathID(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{"1", 1, true},
+		{"9223372036854775807", 9223372036854775807, true},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"1.5", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		// out of the int64 range instead of being wrapped around
+		{"9223372036854775808", 0, false},
+	} {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.SetParamNames("itemID")
+		c.SetParamValues(tt.value)
+
+		got, err := pathID(c, "itemID")
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("pathID(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+		if !tt.ok && !isBadRequest(err) {
+			t.Errorf("pathID(%q) = %d, %v, want a 400", tt.value, got, err)
+		}
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		want  int
+		ok    bool
+	}{
+		{"", 20, true},
+		{"?limit=1", 1, true},
+		{"?limit=100", 100, true},
+		{"?limit=abc", 0, false},
+		{"?limit=0", 0, false},
+		{"?limit=-5", 0, false},
+		{"?limit=101", 0, false},
+	} {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/items"+tt.query, nil), httptest.NewRecorder())
+
+		got, err := queryLimit(c, 20, 100)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("queryLimit(%q) = %d, %v, want %d", tt.query, got, err, tt.want)
+		}
+		if !tt.ok && !isBadRequest(err) {
+			t.Errorf("queryLimit(%q) = %d, %v, want a 400", tt.query, got, err)
+		}
+	}
+}
+
+func isBadRequest(err error) bool {
+	he, ok := err.(*echo.HTTPError)
+	return ok && he.Code == http.StatusBadRequest
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/mail"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength  = 8
+	passwordResetTTL   = 30 * time.Minute
+	passwordResetBytes = 32
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type requestPasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type confirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (h *Handler) ChangePassword(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(changePasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	user, err := h.UserRepo.GetUser(ctx, userID)
+	if err != nil {
+		return preconditionIfNotFound(err)
+	}
+
+	// the current password is guessed like a login, so it is throttled with the same guards
+	accountKey, ipKey := strconv.FormatInt(userID, 10), c.RealIP()
+	if err := h.reserveLogin(c, accountKey, ipKey); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return domain.NewForbiddenError("current password is wrong")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := h.loginSucceeded(c, accountKey, ipKey); err != nil {
+		return err
+	}
+
+	if err := h.setPassword(c, userID, req.NewPassword); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// RequestPasswordReset queues a single use reset token to be mailed to the owner of the email.
+// The email is looked up in the background (RunPasswordResets), so the response is the same,
+// also in timing, whether the email is registered or not and it can't be used to look up accounts.
+// The requests for an email are throttled, whether it is registered or not, so that its owner can't be flooded with mails.
+func (h *Handler) RequestPasswordReset(c echo.Context) error {
+	req := new(requestPasswordResetRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if !validEmail(req.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid email")
+	}
+
+	// the guard keeps a hash only, not the emails which were asked for
+	wait, err := h.ResetGuard.Reserve(c.Request().Context(), hashEmail(req.Email))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return tooManyRequests(c, wait, "too many password reset requests")
+	}
+
+	if !h.PasswordResets.Push(req.Email) {
+		c.Logger().Warn("the password reset queue is full, dropped a request")
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// RunPasswordResets mails the reset tokens requested with RequestPasswordReset until ctx is done.
+func (h *Handler) RunPasswordResets(ctx context.Context) {
+	h.PasswordResets.Run(ctx, func(ctx context.Context, email string) {
+		if err := h.sendPasswordReset(ctx, email); err != nil {
+			log.Printf("failed to send a password reset: %s", err)
+		}
+	})
+}
+
+// sendPasswordReset issues a reset token for the user with the email and mails it,
+// if there is such a user and the token mailed before is used or expired.
+func (h *Handler) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := h.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		var notFound *domain.NotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+
+	buf := make([]byte, passwordResetBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	added, err := h.ResetRepo.AddPasswordReset(ctx, user.ID, hashResetToken(token), now, now.Add(passwordResetTTL))
+	if err != nil || !added {
+		return err
+	}
+
+	return errors.Wrap(h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the following token to reset your password within %d minutes.\n\n%s\n\nIf you didn't request it, you can ignore this mail.\n",
+			user.Name, int(passwordResetTTL.Minutes()), token),
+	}), "failed to send mail")
+}
+
+func (h *Handler) ConfirmPasswordReset(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(confirmPasswordResetRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if req.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token is required")
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return err
+	}
+
+	userID, err := h.ResetRepo.ConsumePasswordReset(ctx, hashResetToken(req.Token), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := h.setPassword(c, userID, req.NewPassword); err != nil {
+		return err
+	}
+	// the owner proved access to the mailbox, so lift the lockout of the account
+	if err := h.AccountGuard.Succeed(ctx, strconv.FormatInt(userID, 10)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) setPassword(c echo.Context, userID int64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return preconditionIfNotFound(h.UserRepo.UpdatePassword(c.Request().Context(), userID, string(hash)))
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+	}
+	// bcrypt ignores the bytes after 72
+	if len(password) > 72 {
+		return echo.NewHTTPError(http.StatusBadRequest, "password is too long")
+	}
+	return nil
+}
+
+// hashEmail returns the key of the email in ResetGuard, the same for any case of it.
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashResetToken returns the value stored in the DB. Only the hash is stored so that a leaked DB can't be used to reset passwords.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/policy"
+)
+
+type reportItemRequest struct {
+	Reason  domain.ReportReason `json:"reason"`
+	Comment string              `json:"comment"`
+}
+
+func (h *Handler) ReportItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := pathID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	req := new(reportItemRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if !req.Reason.Valid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid reason")
+	}
+	if len(req.Comment) > 1000 {
+		return echo.NewHTTPError(http.StatusBadRequest, "comment is too long")
+	}
+
+	subject, err := getSubject(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	if err := policy.CanReport(subject, item); err != nil {
+		return err
+	}
+
+	if _, err := h.ItemRepo.Report(ctx, domain.Report{
+		ItemID:     itemID,
+		ReporterID: subject.UserID,
+		Reason:     req.Reason,
+		Comment:    req.Comment,
+	}, domain.ReportLimits{
+		PerReporter:   h.Config.Report.Limit,
+		Window:        h.Config.Report.Window,
+		HideThreshold: h.Config.Report.HideThreshold,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
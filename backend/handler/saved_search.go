@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/search"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxSavedSearches is the number of saved searches a user can have.
+	maxSavedSearches    = 20
+	maxSavedQueryLength = 100
+)
+
+type addSavedSearchRequest struct {
+	Query       string  `json:"query"`
+	CategoryIDs []int64 `json:"category_ids"`
+	MinPrice    *int64  `json:"min_price"`
+	MaxPrice    *int64  `json:"max_price"`
+}
+
+type addSavedSearchResponse struct {
+	ID int64 `json:"id"`
+}
+
+type savedSearchResponse struct {
+	ID          int64   `json:"id"`
+	Query       string  `json:"query"`
+	CategoryIDs []int64 `json:"category_ids"`
+	MinPrice    *int64  `json:"min_price,omitempty"`
+	MaxPrice    *int64  `json:"max_price,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// AddSavedSearch saves a query and a filter. The user is notified of the items put on sale which match it.
+func (h *Handler) AddSavedSearch(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(addSavedSearchRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if utf8.RuneCountInString(req.Query) > maxSavedQueryLength {
+		return echo.NewHTTPError(http.StatusBadRequest, "query is too long")
+	}
+	if search.Normalize(req.Query) == "" && len(req.CategoryIDs) == 0 && req.MinPrice == nil && req.MaxPrice == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "query or filter is required")
+	}
+	if (req.MinPrice != nil && *req.MinPrice < 0) || (req.MaxPrice != nil && *req.MaxPrice < 0) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid price")
+	}
+	if req.MinPrice != nil && req.MaxPrice != nil && *req.MinPrice > *req.MaxPrice {
+		return echo.NewHTTPError(http.StatusBadRequest, "min_price must not be greater than max_price")
+	}
+	for _, id := range req.CategoryIDs {
+		if _, err := h.ItemRepo.GetCategory(ctx, id); err != nil {
+			var notFound *domain.NotFoundError
+			if errors.As(err, &notFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid category_ids")
+			}
+			return err
+		}
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	saved, err := h.SavedSearchRepo.GetSavedSearchesByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(saved) >= maxSavedSearches {
+		return domain.NewPreconditionFailedError("too many saved searches")
+	}
+
+	id, err := h.SavedSearchRepo.AddSavedSearch(ctx, domain.SavedSearch{
+		UserID:      userID,
+		Query:       req.Query,
+		CategoryIDs: req.CategoryIDs,
+		MinPrice:    req.MinPrice,
+		MaxPrice:    req.MaxPrice,
+	})
+	if err != nil {
+		return preconditionIfNotFound(err)
+	}
+
+	return c.JSON(http.StatusOK, addSavedSearchResponse{ID: id})
+}
+
+func (h *Handler) GetSavedSearches(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	saved, err := h.SavedSearchRepo.GetSavedSearchesByUserID(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	res := make([]savedSearchResponse, len(saved))
+	for i, s := range saved {
+		res[i] = savedSearchResponse{
+			ID:          s.ID,
+			Query:       s.Query,
+			CategoryIDs: s.CategoryIDs,
+			MinPrice:    s.MinPrice,
+			MaxPrice:    s.MaxPrice,
+			CreatedAt:   s.CreatedAt,
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) DeleteSavedSearch(c echo.Context) error {
+	id, err := pathID(c, "savedSearchID")
+	if err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if err := h.SavedSearchRepo.DeleteSavedSearch(c.Request().Context(), id, userID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/search"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+	// minSuggestPrefix is the min number of characters of q after normalization.
+	// Shorter prefixes match too much of the index to be useful as completions.
+	minSuggestPrefix = 2
+)
+
+// Search lists the items on sale whose name or description contains the name query parameter,
+// ignoring the differences Normalize folds. Items matching by name come first.
+// Searches which found items are recorded for the suggestions.
+func (h *Handler) Search(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	name := c.QueryParam("name")
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+
+	items := h.SearchIndex.Search(name)
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(cats))
+	for _, cat := range cats {
+		names[cat.ID] = cat.Name
+	}
+
+	res := make([]getOnSaleItemsResponse, len(items))
+	for i, item := range items {
+		res[i] = getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: names[item.CategoryID]}
+	}
+	if len(items) > 0 {
+		h.SearchIndex.RecordQuery(name)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// Suggest completes the q query parameter with item names, categories and past queries, the most popular first.
+func (h *Handler) Suggest(c echo.Context) error {
+	q := c.QueryParam("q")
+	if utf8.RuneCountInString(search.Normalize(q)) < minSuggestPrefix {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("q must have at least %d characters", minSuggestPrefix))
+	}
+	limit, err := queryLimit(c, defaultSuggestLimit, maxSuggestLimit)
+	if err != nil {
+		return err
+	}
+
+	cats, err := h.ItemRepo.GetCategories(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, h.SearchIndex.Suggest(q, cats, limit))
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	maxUserNameLength = 50
+	maxBioLength      = 500
+	maxAvatarSize     = 1 << 20
+)
+
+// avatarTypes are the image types accepted as avatars. Anything else, e.g. HTML or SVG, could run scripts when opened.
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type getUserProfileResponse struct {
+	ID           int64    `json:"id"`
+	Name         string   `json:"name"`
+	Bio          string   `json:"bio"`
+	AvatarURL    string   `json:"avatar_url,omitempty"`
+	JoinedAt     string   `json:"joined_at"`
+	ListingCount int64    `json:"listing_count"`
+	SoldCount    int64    `json:"sold_count"`
+	Rating       *float64 `json:"rating"`
+}
+
+type updateProfileRequest struct {
+	Name  string `form:"name"`
+	Bio   string `form:"bio"`
+	Email string `form:"email"`
+}
+
+func (h *Handler) GetUserProfile(c echo.Context) error {
+	userID, err := pathID(c, "userID")
+	if err != nil {
+		return err
+	}
+
+	p, err := h.UserRepo.GetUserProfile(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	res := getUserProfileResponse{
+		ID:           p.ID,
+		Name:         p.Name,
+		Bio:          p.Bio,
+		JoinedAt:     p.CreatedAt,
+		ListingCount: p.ListingCount,
+		SoldCount:    p.SoldCount,
+		Rating:       p.Rating,
+	}
+	if p.HasAvatar {
+		res.AvatarURL = fmt.Sprintf("/users/%d/avatar", p.ID)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetUserAvatar(c echo.Context) error {
+	userID, err := pathID(c, "userID")
+	if err != nil {
+		return err
+	}
+
+	data, contentType, err := h.UserRepo.GetUserAvatar(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	// the browser must not guess another type from the content
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Blob(http.StatusOK, contentType, data)
+}
+
+// UpdateMyProfile updates the profile of the logged in user.
+// The avatar is an optional multipart file; the current avatar and email are kept when they are omitted.
+// Its type is detected from the content rather than taken from the request, and must be one of avatarTypes.
+func (h *Handler) UpdateMyProfile(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(updateProfileRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxUserNameLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxUserNameLength))
+	}
+	if utf8.RuneCountInString(req.Bio) > maxBioLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("bio must be at most %d characters", maxBioLength))
+	}
+	if req.Email != "" && !validEmail(req.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid email")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	var (
+		avatar     []byte
+		avatarType string
+	)
+	if file, err := c.FormFile("avatar"); err == nil {
+		if file.Size > maxAvatarSize {
+			return echo.NewHTTPError(http.StatusBadRequest, "avatar is too large")
+		}
+		src, err := file.Open()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		defer src.Close()
+
+		blob := new(bytes.Buffer)
+		if _, err := io.Copy(blob, io.LimitReader(src, maxAvatarSize)); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+		avatar = blob.Bytes()
+		// DetectContentType adds no parameters to the image types
+		avatarType = http.DetectContentType(avatar)
+		if !avatarTypes[avatarType] {
+			return echo.NewHTTPError(http.StatusBadRequest, "avatar must be a PNG, JPEG, GIF or WebP image")
+		}
+	} else if err != http.ErrMissingFile {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := h.UserRepo.UpdateProfile(ctx, domain.User{
+		ID:         userID,
+		Name:       req.Name,
+		Bio:        req.Bio,
+		Email:      req.Email,
+		Avatar:     avatar,
+		AvatarType: avatarType,
+	}); err != nil {
+		return preconditionIfNotFound(err)
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// validEmail accepts a bare address such as "user@example.com".
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 254
+}
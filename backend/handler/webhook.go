@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	// maxWebhooks is the number of webhooks an admin can have.
+	maxWebhooks        = 20
+	maxWebhookURLLen   = 2048
+	minWebhookSecret   = 16
+	maxWebhookSecret   = 256
+	defaultDeliveryLog = 50
+	maxDeliveryLog     = 200
+)
+
+type addWebhookRequest struct {
+	URL        string             `json:"url"`
+	EventTypes []domain.EventType `json:"event_types"`
+	Secret     string             `json:"secret"`
+}
+
+type addWebhookResponse struct {
+	ID int64 `json:"id"`
+}
+
+// webhookResponse leaves out the secret, which is only known to the one who set it.
+type webhookResponse struct {
+	ID         int64              `json:"id"`
+	URL        string             `json:"url"`
+	EventTypes []domain.EventType `json:"event_types"`
+	CreatedAt  string             `json:"created_at"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             int64                        `json:"id"`
+	EventType      domain.EventType             `json:"event_type"`
+	Payload        json.RawMessage              `json:"payload"`
+	Status         domain.WebhookDeliveryStatus `json:"status"`
+	Attempts       int                          `json:"attempts"`
+	ResponseStatus int                          `json:"response_status,omitempty"`
+	LastError      string                       `json:"last_error,omitempty"`
+	NextAttemptAt  string                       `json:"next_attempt_at,omitempty"`
+	DeliveredAt    string                       `json:"delivered_at,omitempty"`
+	CreatedAt      string                       `json:"created_at"`
+}
+
+// AddWebhook subscribes an endpoint to the events of the types. The events raised from now on are posted to it.
+func (h *Handler) AddWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(addWebhookRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		return err
+	}
+	if len(req.EventTypes) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "event_types is required")
+	}
+	eventTypes := make([]domain.EventType, 0, len(req.EventTypes))
+	seen := map[domain.EventType]bool{}
+	for _, t := range req.EventTypes {
+		if !t.Valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid event_types")
+		}
+		if !seen[t] {
+			seen[t] = true
+			eventTypes = append(eventTypes, t)
+		}
+	}
+	if n := utf8.RuneCountInString(req.Secret); n < minWebhookSecret || n > maxWebhookSecret {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret must be 16 to 256 characters")
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	webhooks, err := h.WebhookRepo.GetWebhooksByUserID(ctx, adminID)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) >= maxWebhooks {
+		return domain.NewPreconditionFailedError("too many webhooks")
+	}
+
+	id, err := h.WebhookRepo.AddWebhook(ctx, domain.Webhook{
+		UserID:     adminID,
+		URL:        req.URL,
+		EventTypes: eventTypes,
+		Secret:     req.Secret,
+	}, domain.AuditLog{
+		AdminID:    adminID,
+		Action:     domain.AuditActionCreateWebhook,
+		TargetType: "webhook",
+	})
+	if err != nil {
+		return preconditionIfNotFound(err)
+	}
+
+	return c.JSON(http.StatusOK, addWebhookResponse{ID: id})
+}
+
+func (h *Handler) GetWebhooks(c echo.Context) error {
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	webhooks, err := h.WebhookRepo.GetWebhooksByUserID(c.Request().Context(), adminID)
+	if err != nil {
+		return err
+	}
+
+	res := make([]webhookResponse, len(webhooks))
+	for i, w := range webhooks {
+		res[i] = webhookResponse{ID: w.ID, URL: w.URL, EventTypes: w.EventTypes, CreatedAt: w.CreatedAt}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteWebhook stops sending events to the webhook. Its pending deliveries and its delivery log are deleted.
+func (h *Handler) DeleteWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	webhook, err := h.getOwnWebhook(c)
+	if err != nil {
+		return err
+	}
+	if err := h.WebhookRepo.DeleteWebhook(ctx, webhook.ID, domain.AuditLog{
+		AdminID:    webhook.UserID,
+		Action:     domain.AuditActionDeleteWebhook,
+		TargetType: "webhook",
+		TargetID:   webhook.ID,
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, the newest first.
+func (h *Handler) GetWebhookDeliveries(c echo.Context) error {
+	limit, err := queryLimit(c, defaultDeliveryLog, maxDeliveryLog)
+	if err != nil {
+		return err
+	}
+
+	webhook, err := h.getOwnWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := h.WebhookRepo.GetDeliveriesByWebhookID(c.Request().Context(), webhook.ID, limit)
+	if err != nil {
+		return err
+	}
+
+	res := make([]webhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		res[i] = webhookDeliveryResponse{
+			ID:             d.ID,
+			EventType:      d.EventType,
+			Payload:        d.Payload,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			ResponseStatus: d.ResponseStatus,
+			LastError:      d.LastError,
+			DeliveredAt:    d.DeliveredAt,
+			CreatedAt:      d.CreatedAt,
+		}
+		if d.Status == domain.WebhookDeliveryStatusPending {
+			res[i].NextAttemptAt = d.NextAttemptAt
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// RedeliverWebhookDelivery sends a delivery again with fresh attempts, typically one in the dead letter state.
+func (h *Handler) RedeliverWebhookDelivery(c echo.Context) error {
+	deliveryID, err := pathID(c, "deliveryID")
+	if err != nil {
+		return err
+	}
+
+	webhook, err := h.getOwnWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Webhooks.Redeliver(c.Request().Context(), deliveryID, webhook.ID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// getOwnWebhook returns the webhook in the path. Webhooks of other admins are not found.
+func (h *Handler) getOwnWebhook(c echo.Context) (domain.Webhook, error) {
+	id, err := pathID(c, "webhookID")
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return domain.Webhook{}, echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	webhook, err := h.WebhookRepo.GetWebhook(c.Request().Context(), id)
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+	if webhook.UserID != adminID {
+		return domain.Webhook{}, domain.NewNotFoundError("webhook not found")
+	}
+	return webhook, nil
+}
+
+// validateWebhookURL accepts absolute http and https URLs.
+func validateWebhookURL(raw string) error {
+	if raw == "" || len(raw) > maxWebhookURLLen {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid url")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid url")
+	}
+	return nil
+}
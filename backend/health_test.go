@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, tt := range []struct {
+		name    string
+		ready   bool
+		healthz int
+		readyz  int
+	}{
+		{"serving", true, http.StatusOK, http.StatusOK},
+		// on shutdown only /readyz turns unavailable, the process is still healthy
+		{"shutting down", false, http.StatusOK, http.StatusServiceUnavailable},
+		{"ready again", true, http.StatusOK, http.StatusOK},
+	} {
+		s.h.SetReady(tt.ready)
+		for path, want := range map[string]int{"/healthz": tt.healthz, "/readyz": tt.readyz} {
+			var health struct {
+				Status string `json:"status"`
+			}
+			status := s.do(http.MethodGet, path, "", nil, &health)
+			if status != want {
+				t.Errorf("%s: %s = %d, want %d", tt.name, path, status, want)
+			}
+			if status == http.StatusOK && health.Status != "ok" {
+				t.Errorf("%s: %s status = %q, want ok", tt.name, path, health.Status)
+			}
+		}
+	}
+}
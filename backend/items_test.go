@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestItemFilter(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.registerAdmin("admin")
+	aliceID, alice := s.register("alice")
+	_, bob := s.register("bob")
+	_, buyer := s.register("buyer")
+
+	var jackets struct {
+		ID int64 `json:"id"`
+	}
+	s.mustDo(http.MethodPost, "/admin/categories", admin, map[string]any{"name": "jackets", "parent_id": 1}, &jackets)
+
+	s.sellIn(alice, "shirt", 1, 500)
+	s.sellIn(alice, "jacket", jackets.ID, 4000)
+	s.sellIn(bob, "novel", 2, 1500)
+	old := s.sellIn(bob, "old book", 2, 800)
+	comic := s.sellIn(bob, "comic", 2, 12000)
+	s.mustDo(http.MethodPost, "/balance", buyer, map[string]int64{"balance": 20000}, nil)
+	s.mustDo(http.MethodPost, fmt.Sprintf("/purchase/%d", comic), buyer, nil, nil)
+	if _, err := s.db.Write.Exec("UPDATE items SET created_at = '2020-01-01 00:00:00' WHERE id = ?", old); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"jacket", "novel", "old book", "shirt"}},
+		// with the descendants of the category
+		{"category_id=1", []string{"jacket", "shirt"}},
+		{fmt.Sprintf("category_id=%d", jackets.ID), []string{"jacket"}},
+		{"category_id=1,2", []string{"jacket", "novel", "old book", "shirt"}},
+		{"category_id=1&category_id=2", []string{"jacket", "novel", "old book", "shirt"}},
+		{"min_price=1000", []string{"jacket", "novel"}},
+		{"max_price=800", []string{"old book", "shirt"}},
+		{"min_price=1000&max_price=1500", []string{"novel"}},
+		{fmt.Sprintf("seller_id=%d", aliceID), []string{"jacket", "shirt"}},
+		{"status=3", []string{"comic"}},
+		{"created_after=2021-01-01", []string{"jacket", "novel", "shirt"}},
+		{"created_after=" + url.QueryEscape("2021-01-01T00:00:00+09:00"), []string{"jacket", "novel", "shirt"}},
+		{"category_id=2&max_price=1000", []string{"old book"}},
+		{"seller_id=12345", nil},
+	} {
+		var items []struct {
+			Name string `json:"name"`
+		}
+		s.mustDo(http.MethodGet, "/items?"+tt.query, "", nil, &items)
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /items?%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{
+		"category_id=abc",
+		"category_id=1,",
+		"min_price=-1",
+		"max_price=cheap",
+		"min_price=2000&max_price=1000",
+		"seller_id=0",
+		"status=1",
+		"status=4",
+		"created_after=yesterday",
+	} {
+		if status := s.do(http.MethodGet, "/items?"+query, "", nil, nil); status != http.StatusBadRequest {
+			t.Errorf("GET /items?%s: status %d, want 400", query, status)
+		}
+	}
+}
+
+func TestItemFacets(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+
+	s.sellIn(alice, "shirt", 1, 500)
+	s.sellIn(alice, "novel", 2, 1500)
+	s.sellIn(alice, "old book", 2, 800)
+	s.sellIn(alice, "dictionary", 2, 30000)
+
+	type facets struct {
+		Categories []struct {
+			CategoryID   int64  `json:"category_id"`
+			CategoryName string `json:"category_name"`
+			Count        int    `json:"count"`
+		} `json:"categories"`
+		Prices []struct {
+			Min   int64 `json:"min"`
+			Max   int64 `json:"max"`
+			Count int   `json:"count"`
+		} `json:"prices"`
+	}
+	var res struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+		Facets facets `json:"facets"`
+	}
+
+	s.mustDo(http.MethodGet, "/items?facets=true", "", nil, &res)
+	if len(res.Items) != 4 {
+		t.Errorf("%d items with the facets, want 4", len(res.Items))
+	}
+	// the categories with the most items first
+	if got := fmt.Sprint(res.Facets.Categories); got != "[{2 books 3} {1 fashion 1}]" {
+		t.Errorf("category facets = %s", got)
+	}
+	// every bucket is present, the last one without an upper bound
+	if got := fmt.Sprint(res.Facets.Prices); got != "[{0 1000 2} {1000 3000 1} {3000 5000 0} {5000 10000 0} {10000 30000 0} {30000 0 1}]" {
+		t.Errorf("price facets = %s", got)
+	}
+
+	// the facets count the filtered items
+	s.mustDo(http.MethodGet, "/items?facets=true&max_price=1000", "", nil, &res)
+	if got := fmt.Sprint(res.Facets.Categories); got != "[{2 books 1} {1 fashion 1}]" {
+		t.Errorf("category facets of the filtered items = %s", got)
+	}
+	if got := res.Facets.Prices[0].Count; got != 2 {
+		t.Errorf("count of the first price bucket of the filtered items = %d, want 2", got)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/handler"
+)
+
+func TestLikes(t *testing.T) {
+	s := newTestServer(t)
+	_, seller := s.register("seller")
+	aliceID, alice := s.register("alice")
+	_, bob := s.register("bob")
+	id := s.sell(seller, "leather jacket", 500)
+	likePath := fmt.Sprintf("/items/%d/like", id)
+
+	type itemLikes struct {
+		LikeCount int64 `json:"like_count"`
+		LikedByMe bool  `json:"liked_by_me"`
+	}
+	get := func(token string) itemLikes {
+		t.Helper()
+		var item itemLikes
+		s.mustDo(http.MethodGet, fmt.Sprintf("/items/%d", id), token, nil, &item)
+		return item
+	}
+
+	// liking again is not counted twice
+	s.mustDo(http.MethodPost, likePath, alice, nil, nil)
+	s.mustDo(http.MethodPost, likePath, alice, nil, nil)
+	s.mustDo(http.MethodPost, likePath, bob, nil, nil)
+	if code := s.do(http.MethodPost, likePath, seller, nil, nil); code == http.StatusOK {
+		t.Error("the seller liked their own item")
+	}
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &handler.JwtCustomClaims{
+		UserID:           aliceID,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+	}).SignedString([]byte(s.cfg.Auth.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  itemLikes
+	}{
+		{"liker", alice, itemLikes{2, true}},
+		{"seller", seller, itemLikes{2, false}},
+		{"anonymous", "", itemLikes{2, false}},
+		// the token is optional, so a broken one is the same as none rather than a 401
+		{"malformed token", "not-a-jwt", itemLikes{2, false}},
+		{"expired token", expired, itemLikes{2, false}},
+	} {
+		if got := get(tt.token); got != tt.want {
+			t.Errorf("%s: likes = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	s.mustDo(http.MethodDelete, likePath, alice, nil, nil)
+	s.mustDo(http.MethodDelete, likePath, alice, nil, nil)
+	if got, want := get(alice), (itemLikes{1, false}); got != want {
+		t.Errorf("likes after unlike = %+v, want %+v", got, want)
+	}
+
+	// the likers other than the buyer are told that the item was sold
+	s.mustDo(http.MethodPost, likePath, alice, nil, nil)
+	s.mustDo(http.MethodPost, "/balance", bob, map[string]int64{"balance": 1000}, nil)
+	s.mustDo(http.MethodPost, fmt.Sprintf("/purchase/%d", id), bob, nil, nil)
+
+	s.eventually("the liked_item_sold notification", func() bool {
+		return len(s.notifications(alice)) > 0
+	})
+	if n := s.notifications(alice)[0]; n.Kind != "liked_item_sold" || n.ItemID != id {
+		t.Errorf("notification of the liker = %+v", n)
+	}
+	for _, n := range s.notifications(bob) {
+		if n.Kind == "liked_item_sold" {
+			t.Errorf("the buyer was notified that the item they liked was sold: %+v", n)
+		}
+	}
+}
+
+func TestMissingItem(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+
+	for _, tt := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodPost, "/items/12345/like", nil},
+		{http.MethodPost, "/items/12345/comments", map[string]string{"body": "is it still available?"}},
+	} {
+		if status := s.do(tt.method, tt.path, alice, tt.body, nil); status != http.StatusNotFound {
+			t.Errorf("%s %s: status %d, want 404", tt.method, tt.path, status)
+		}
+	}
+}
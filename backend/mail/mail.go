@@ -0,0 +1,85 @@
+// Package mail sends emails to users.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends plain text mails through an SMTP server.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer for the server at addr (host:port). PLAIN auth is used when username is set.
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{Addr: addr, From: from}
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// LogMailer writes mails to w instead of sending them. It is meant for local development.
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "----- %s -----\n%s\n", time.Now().Format(time.RFC3339), format("noreply@localhost", msg))
+	return err
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", headerValue(msg.Subject)))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+// headerValue drops line breaks so that values can't inject headers.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
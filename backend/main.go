@@ -4,17 +4,32 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/cache"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
 	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/events"
 	"github.com/mercari-build/mecari-build-hackathon-2023/backend/handler"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/mail"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/notification"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/ratelimit"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/realtime"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/search"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/throttle"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/webhook"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/worker"
 )
 
 const (
@@ -27,92 +42,421 @@ func main() {
 }
 
 func run(ctx context.Context) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %s\n", err)
+		return exitError
+	}
+
 	e := echo.New()
+	e.HTTPErrorHandler = handler.HTTPErrorHandler
+	e.IPExtractor = ipExtractor(cfg.Server.TrustedProxies)
 
 	// Middleware
 	e.Use(middleware.Recover())
 
-	logfile := os.Getenv("LOGFILE")
-	if logfile == "" {
-		logfile = "access.log"
+	lf, err := os.OpenFile(cfg.Server.AccessLogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open access log: %s\n", err)
+		return exitError
 	}
-	lf, _ := os.OpenFile(logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	logger := middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: logFormat(),
 		Output: io.MultiWriter(os.Stdout, lf),
 	})
 	e.Use(logger)
 
-	frontURL := os.Getenv("FRONT_URL")
-	if frontURL == "" {
-		frontURL = "http://localhost:3000"
-	}
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{frontURL},
+		AllowOrigins: []string{cfg.Server.FrontURL},
 		AllowMethods: []string{"GET", "PUT", "DELETE", "OPTIONS", "POST"},
 	}))
-	e.Use(middleware.BodyLimit("5M"))
-
-	// jwt
-	config := echojwt.Config{
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(handler.JwtCustomClaims)
-		},
-		SigningKey: []byte(handler.GetSecret()),
-	}
+	e.Use(middleware.BodyLimit(cfg.Server.BodyLimit))
 
 	// db
-	sqlDB, err := db.PrepareDB(ctx)
+	sqlDB, err := db.PrepareDB(ctx, &cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to prepare DB: %s\n", err)
 		return exitError
 	}
-	defer sqlDB.Close()
+	defer func() {
+		// runs after the shutdown below, when nothing uses the DB anymore
+		if err := db.Checkpoint(context.Background(), sqlDB); err != nil {
+			e.Logger.Error(err)
+		}
+		if err := sqlDB.Close(); err != nil {
+			e.Logger.Error(err)
+		}
+	}()
+
+	workers := worker.NewGroup()
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare mailer: %s\n", err)
+		return exitError
+	}
+
+	h, err := newHandler(ctx, &cfg, sqlDB, mailer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare repositories: %s\n", err)
+		return exitError
+	}
+	warnings, err := sqlDB.CheckQueryPlans(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check query plans: %s\n", err)
+		return exitError
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	workers.Go(func(ctx context.Context) {
+		flushSearchQueries(ctx, h, time.Minute)
+	})
+	workers.Go(h.Notifier.Run)
+	workers.Go(h.RunPasswordResets)
+
+	outbox, err := db.NewOutboxRepository(ctx, sqlDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare outbox: %s\n", err)
+		return exitError
+	}
+	bus := events.NewBus(outbox, sqlDB.OutboxWritten())
+	subscribeEvents(bus, h)
+	workers.Go(bus.Run)
+	workers.Go(h.Webhooks.Run)
+
+	registerRoutes(e, h, &cfg)
+
+	// Start server
+	go func() {
+		if err := e.Start(cfg.Server.Addr); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal("shutting down the server")
+		}
+	}()
+	h.SetReady(true)
+
+	// containers are stopped with SIGTERM
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	h.SetReady(false)
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	code := exitOK
+	// end the event streams, which would keep the shutdown waiting
+	h.Hub.Close()
+	// wait for in-flight requests first as they may start background work
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+		code = exitError
+	}
+	if err := workers.Shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+		code = exitError
+	}
+
+	return code
+}
+
+// newHandler creates the handler with its repositories on sqlDB.
+func newHandler(ctx context.Context, cfg *config.Config, sqlDB *db.DB, mailer mail.Mailer) (*handler.Handler, error) {
+	loginAttempts := throttle.NewMemoryStore(time.Hour)
+
+	h := &handler.Handler{
+		Config:         cfg,
+		DB:             sqlDB,
+		Mailer:         mailer,
+		PasswordResets: worker.NewBoundedQueue[string](1024),
+		AccountGuard: throttle.NewGuard(loginAttempts, "user:", throttle.Config{
+			FreeAttempts:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         time.Minute,
+			LockoutThreshold: 10,
+			LockoutDuration:  15 * time.Minute,
+			ResetAfter:       time.Hour,
+		}),
+		IPGuard: throttle.NewGuard(loginAttempts, "ip:", throttle.Config{
+			FreeAttempts:     20,
+			BaseDelay:        time.Second,
+			MaxDelay:         time.Minute,
+			LockoutThreshold: 100,
+			LockoutDuration:  15 * time.Minute,
+			ResetAfter:       time.Hour,
+		}),
+		// every request counts; a user is mailed a new token only once the one before was used or expired anyway
+		ResetGuard: throttle.NewGuard(loginAttempts, "reset:", throttle.Config{
+			FreeAttempts:     3,
+			BaseDelay:        time.Minute,
+			MaxDelay:         15 * time.Minute,
+			LockoutThreshold: 10,
+			LockoutDuration:  time.Hour,
+			ResetAfter:       time.Hour,
+		}),
+	}
+
+	if err := prepareRepositories(ctx, h, sqlDB); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
 
-	h := handler.Handler{
-		DB:       sqlDB,
-		UserRepo: db.NewUserRepository(sqlDB),
-		ItemRepo: db.NewItemRepository(sqlDB),
+// registerRoutes adds the routes of h to e.
+func registerRoutes(e *echo.Echo, h *handler.Handler, cfg *config.Config) {
+	jwtConfig := echojwt.Config{
+		NewClaimsFunc: func(c echo.Context) jwt.Claims {
+			return new(handler.JwtCustomClaims)
+		},
+		SigningKey: []byte(cfg.Auth.Secret),
+	}
+	// for public routes which tell a logged in user more, e.g. whether they like an item.
+	// Requests without a valid token are served as anonymous.
+	optionalJWTConfig := jwtConfig
+	optionalJWTConfig.ContinueOnIgnoredError = true
+	optionalJWTConfig.ErrorHandler = func(c echo.Context, err error) error {
+		return nil
 	}
 
+	limiters := ratelimit.New(cfg.RateLimit)
+
 	// Routes
 	e.POST("/initialize", h.Initialize)
 	e.GET("/log", h.AccessLog)
+	e.GET("/healthz", h.Healthz)
+	e.GET("/readyz", h.Readyz)
 
-	e.GET("/items", h.GetOnSaleItems)
-	e.GET("/items/:itemID", h.GetItem)
-	e.GET("/items/:itemID/image", h.GetImage)
-	e.GET("/items/categories", h.GetCategories)
-	e.POST("/register", h.Register)
-	e.POST("/login", h.Login)
+	p := e.Group("", limiters.Middleware(ratelimit.ScopePublic, ratelimit.KeyByIP))
+	p.GET("/items", h.GetOnSaleItems)
+	p.GET("/items/:itemID", h.GetItem, echojwt.WithConfig(optionalJWTConfig))
+	p.GET("/items/:itemID/image", h.GetImage)
+	p.GET("/items/:itemID/comments", h.GetComments)
+	p.GET("/items/categories", h.GetCategories)
+	p.GET("/categories", h.GetCategoryTree)
+	p.GET("/search", h.Search)
+	p.GET("/search/suggest", h.Suggest)
+	p.GET("/categories/:categoryID/items", h.GetCategoryItems)
+	p.GET("/users/:userID", h.GetUserProfile)
+	p.GET("/users/:userID/avatar", h.GetUserAvatar)
+	p.POST("/register", h.Register)
+	p.POST("/login", h.Login)
+	p.POST("/password-reset/request", h.RequestPasswordReset)
+	p.POST("/password-reset/confirm", h.ConfirmPasswordReset)
 
 	// Login required
 	l := e.Group("")
-	l.Use(echojwt.WithConfig(config))
+	l.Use(echojwt.WithConfig(jwtConfig), h.RejectSuspended, limiters.Middleware(ratelimit.ScopeAuthenticated, handler.RateLimitKey))
 	l.GET("/users/:userID/items", h.GetUserItems)
+	l.PUT("/users/me", h.UpdateMyProfile)
+	l.PUT("/users/me/password", h.ChangePassword)
 	l.POST("/items", h.AddItem)
 	l.POST("/sell", h.Sell)
 	l.POST("/purchase/:itemID", h.Purchase)
+	l.POST("/items/:itemID/reports", h.ReportItem)
+	l.POST("/saved-searches", h.AddSavedSearch)
+	l.GET("/saved-searches", h.GetSavedSearches)
+	l.DELETE("/saved-searches/:savedSearchID", h.DeleteSavedSearch)
+	l.POST("/items/:itemID/like", h.LikeItem)
+	l.DELETE("/items/:itemID/like", h.UnlikeItem)
+	l.GET("/users/me/likes", h.GetMyLikes)
+	l.POST("/items/:itemID/comments", h.AddComment)
+	l.DELETE("/items/:itemID/comments/:commentID", h.DeleteComment)
+	l.GET("/notifications", h.GetNotifications)
+	l.POST("/notifications/read", h.ReadNotifications)
+	l.GET("/notifications/preferences", h.GetNotificationPreferences)
+	l.PUT("/notifications/preferences", h.UpdateNotificationPreferences)
 	l.GET("/balance", h.GetBalance)
 	l.POST("/balance", h.AddBalance)
 
-	// Start server
-	go func() {
-		if err := e.Start(":9000"); err != nil && err != http.ErrServerClosed {
-			e.Logger.Fatal("shutting down the server")
+	// EventSource can't set the Authorization header, so the stream also takes the token as a query parameter.
+	// It is long-lived and not rate limited.
+	e.GET("/events", h.Events, handler.TokenFromQuery, echojwt.WithConfig(jwtConfig), h.RejectSuspended)
+
+	// Admin only
+	a := l.Group("/admin", handler.AdminOnly)
+	a.POST("/users/:userID/suspend", h.SuspendUser)
+	a.POST("/users/:userID/unsuspend", h.UnsuspendUser)
+	a.POST("/users/:userID/balance", h.AdjustBalance)
+	a.POST("/items/:itemID/takedown", h.TakeDownItem)
+	a.POST("/items/:itemID/restore", h.RestoreItem)
+	a.GET("/flags", h.GetFlags)
+	a.GET("/audit-logs", h.GetAuditLogs)
+	a.GET("/cache", h.GetCacheStats)
+	a.POST("/categories", h.AddCategory)
+	a.POST("/categories/:categoryID/rename", h.RenameCategory)
+	a.POST("/categories/:categoryID/move", h.MoveCategory)
+	a.DELETE("/categories/:categoryID", h.DeleteCategory)
+
+	// Webhooks are sent the events of every user, so they are managed by admins
+	w := l.Group("/webhooks", handler.AdminOnly)
+	w.POST("", h.AddWebhook)
+	w.GET("", h.GetWebhooks)
+	w.DELETE("/:webhookID", h.DeleteWebhook)
+	w.GET("/:webhookID/deliveries", h.GetWebhookDeliveries)
+	w.POST("/:webhookID/deliveries/:deliveryID/redeliver", h.RedeliverWebhookDelivery)
+}
+
+// prepareRepositories sets the repositories of h. Each of them prepares its statements when it is created.
+func prepareRepositories(ctx context.Context, h *handler.Handler, sqlDB *db.DB) (err error) {
+	if h.UserRepo, err = db.NewUserRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	if h.ItemRepo, err = db.NewItemRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	h.ItemCache = cache.NewItemRepository(h.ItemRepo, h.Config.Cache.Items, h.Config.Cache.ItemTTL)
+	h.ItemRepo = h.ItemCache
+	if h.SearchRepo, err = db.NewSearchRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	h.SearchIndex = search.NewIndex(search.BigramTokenizer{})
+	if err := h.SearchIndex.Load(ctx, h.SearchRepo); err != nil {
+		return err
+	}
+	h.ItemRepo = search.NewItemRepository(h.ItemRepo, h.SearchIndex)
+	if h.SavedSearchRepo, err = db.NewSavedSearchRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	if h.NotificationRepo, err = db.NewNotificationRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	if h.LikeRepo, err = db.NewLikeRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	if h.CommentRepo, err = db.NewCommentRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	h.Hub = realtime.NewHub()
+	h.Notifier = notification.NewService(h.NotificationRepo, h.UserRepo, h.Hub, h.Mailer)
+	h.Matcher = search.NewMatcher(h.ItemRepo, h.SavedSearchRepo, h.Notifier)
+	if h.WebhookRepo, err = db.NewWebhookRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	h.Webhooks = webhook.NewDispatcher(h.WebhookRepo, nil, h.Config.Webhook)
+	if h.AuditRepo, err = db.NewAuditRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	if h.ReportRepo, err = db.NewReportRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	if h.ResetRepo, err = db.NewPasswordResetRepository(ctx, sqlDB); err != nil {
+		return err
+	}
+	return nil
+}
+
+// subscribeEvents registers the handlers of the domain events which don't have to be done in the request.
+// The names are recorded in the outbox, so renaming a subscriber makes the pending events be dispatched to it again.
+func subscribeEvents(bus *events.Bus, h *handler.Handler) {
+	bus.Subscribe(domain.EventTypeItemListed, "realtime", func(ctx context.Context, e domain.Event) error {
+		listed := e.(domain.ItemListed)
+		h.Hub.Publish(realtime.ItemStatusChanged(listed.ItemID, domain.ItemStatusOnSale))
+		return nil
+	})
+	bus.Subscribe(domain.EventTypeItemListed, "saved_searches", func(ctx context.Context, e domain.Event) error {
+		return h.Matcher.Match(ctx, e.(domain.ItemListed).ItemID)
+	})
+
+	bus.Subscribe(domain.EventTypeItemSold, "realtime", func(ctx context.Context, e domain.Event) error {
+		sold := e.(domain.ItemSold)
+		h.Hub.Publish(
+			realtime.ItemStatusChanged(sold.ItemID, domain.ItemStatusSoldOut),
+			realtime.BalanceChanged(sold.BuyerID, sold.BuyerBalance),
+			realtime.BalanceChanged(sold.SellerID, sold.SellerBalance),
+		)
+		return nil
+	})
+	bus.Subscribe(domain.EventTypeItemSold, "notifications", func(ctx context.Context, e domain.Event) error {
+		return h.Notifier.Publish(ctx, notification.ItemSold(e.(domain.ItemSold)))
+	})
+
+	bus.Subscribe(domain.EventTypeItemSold, "likes", func(ctx context.Context, e domain.Event) error {
+		sold := e.(domain.ItemSold)
+		likers, err := h.LikeRepo.GetLikerIDs(ctx, sold.ItemID)
+		if err != nil {
+			return err
 		}
-	}()
+		var notifications []domain.Notification
+		for _, id := range likers {
+			if id != sold.BuyerID {
+				notifications = append(notifications, notification.LikedItemSold(id, sold))
+			}
+		}
+		return h.Notifier.Publish(ctx, notifications...)
+	})
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+	bus.Subscribe(domain.EventTypeBalanceToppedUp, "realtime", func(ctx context.Context, e domain.Event) error {
+		topUp := e.(domain.BalanceToppedUp)
+		h.Hub.Publish(realtime.BalanceChanged(topUp.UserID, topUp.Balance))
+		return nil
+	})
+	bus.Subscribe(domain.EventTypeBalanceToppedUp, "notifications", func(ctx context.Context, e domain.Event) error {
+		topUp := e.(domain.BalanceToppedUp)
+		return h.Notifier.Publish(ctx, notification.BalanceChanged(topUp.UserID, topUp.Amount, topUp.Balance))
+	})
+
+	bus.Subscribe(domain.EventTypeBalanceAdjusted, "realtime", func(ctx context.Context, e domain.Event) error {
+		adjusted := e.(domain.BalanceAdjusted)
+		h.Hub.Publish(realtime.BalanceChanged(adjusted.UserID, adjusted.Balance))
+		return nil
+	})
+	bus.Subscribe(domain.EventTypeBalanceAdjusted, "notifications", func(ctx context.Context, e domain.Event) error {
+		adjusted := e.(domain.BalanceAdjusted)
+		return h.Notifier.Publish(ctx, notification.BalanceChanged(adjusted.UserID, adjusted.Amount, adjusted.Balance))
+	})
+
+	for _, t := range domain.EventTypes {
+		bus.Subscribe(t, "webhooks", h.Webhooks.Enqueue)
+	}
+}
+
+// flushSearchQueries saves the recorded search queries every interval and once more on shutdown.
+func flushSearchQueries(ctx context.Context, h *handler.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.SearchIndex.Flush(ctx, h.SearchRepo); err != nil {
+				log.Printf("failed to save search queries: %s", err)
+			}
+		case <-ctx.Done():
+			// ctx is already canceled, but the DB is closed only after the workers are done
+			if err := h.SearchIndex.Flush(context.Background(), h.SearchRepo); err != nil {
+				log.Printf("failed to save search queries: %s", err)
+			}
+			return
+		}
+	}
+}
+
+// ipExtractor takes the client IP from X-Forwarded-For only when the request comes through one of the trusted proxies.
+// Otherwise the header could be set by the client, e.g. to get a fresh rate limit with every request.
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		// validated by config
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		options = append(options, echo.TrustIPRange(ipNet))
 	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
 
-	return exitOK
+func newMailer(cfg config.Mail) (mail.Mailer, error) {
+	if cfg.SMTPAddr != "" {
+		return mail.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	}
+
+	f, err := os.OpenFile(cfg.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return mail.NewLogMailer(f), nil
 }
 
 func logFormat() string {
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/events"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/handler"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/mail"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/worker"
+)
+
+// testServer serves the routes of the app on a DB in a temporary directory, with the event bus running.
+type testServer struct {
+	t     *testing.T
+	cfg   *config.Config
+	db    *db.DB
+	h     *handler.Handler
+	mails *mailRecorder
+	url   string
+}
+
+// mailRecorder keeps the sent mails instead of sending them.
+type mailRecorder struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *mailRecorder) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *mailRecorder) Sent() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.sent...)
+}
+
+// newTestServer starts a test server. The configure funcs can change the config before it starts.
+func newTestServer(t *testing.T, configure ...func(*config.Config)) *testServer {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg := config.Default()
+	cfg.DB.Path = filepath.Join(t.TempDir(), "mercari.sqlite3")
+	cfg.Auth.Secret = "test-secret-of-the-test-server"
+	// the tight route rules of the default config would get in the way of the tests here
+	cfg.RateLimit.Routes = nil
+	for _, f := range configure {
+		f(&cfg)
+	}
+
+	sqlDB, err := db.PrepareDB(ctx, &cfg)
+	if err != nil {
+		t.Fatalf("failed to prepare DB: %s", err)
+	}
+	if _, err := sqlDB.Write.ExecContext(ctx, "INSERT INTO category (id, name) VALUES (1, 'fashion'), (2, 'books')"); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := &mailRecorder{}
+	h, err := newHandler(ctx, &cfg, sqlDB, mails)
+	if err != nil {
+		t.Fatalf("failed to prepare handler: %s", err)
+	}
+
+	outbox, err := db.NewOutboxRepository(ctx, sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus(outbox, sqlDB.OutboxWritten())
+	subscribeEvents(bus, h)
+	workers := worker.NewGroup()
+	workers.Go(bus.Run)
+	workers.Go(h.Notifier.Run)
+	workers.Go(h.RunPasswordResets)
+
+	e := echo.New()
+	e.HTTPErrorHandler = handler.HTTPErrorHandler
+	e.IPExtractor = ipExtractor(cfg.Server.TrustedProxies)
+	registerRoutes(e, h, &cfg)
+	srv := httptest.NewServer(e)
+
+	t.Cleanup(func() {
+		srv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := workers.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+		sqlDB.Close()
+	})
+	return &testServer{t: t, cfg: &cfg, db: sqlDB, h: h, mails: mails, url: srv.URL}
+}
+
+// do sends a JSON request with the token, when it is not empty, and decodes the JSON response into res, when it is not nil.
+func (s *testServer) do(method, path, token string, body, res any) int {
+	s.t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, s.url+path, r)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	return s.send(req, token, res)
+}
+
+func (s *testServer) send(req *http.Request, token string, res any) int {
+	s.t.Helper()
+
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if res != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+			s.t.Fatalf("failed to decode the response of %s %s: %s", req.Method, req.URL.Path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// mustDo is do which fails the test unless the response is 200.
+func (s *testServer) mustDo(method, path, token string, body, res any) {
+	s.t.Helper()
+	if status := s.do(method, path, token, body, res); status != http.StatusOK {
+		s.t.Fatalf("%s %s: status %d", method, path, status)
+	}
+}
+
+// register adds a user with the password "password" and logs in.
+func (s *testServer) register(name string) (int64, string) {
+	s.t.Helper()
+
+	var reg struct {
+		ID int64 `json:"id"`
+	}
+	s.mustDo(http.MethodPost, "/register", "", map[string]string{"name": name, "password": "password"}, &reg)
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.mustDo(http.MethodPost, "/login", "", map[string]any{"user_id": reg.ID, "password": "password"}, &login)
+	return reg.ID, login.Token
+}
+
+// registerAdmin adds a user with the admin role and logs in, so that the role is in the token.
+func (s *testServer) registerAdmin(name string) (int64, string) {
+	s.t.Helper()
+
+	id, _ := s.register(name)
+	if _, err := s.db.Write.Exec("UPDATE users SET role = 'admin' WHERE id = ?", id); err != nil {
+		s.t.Fatal(err)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.mustDo(http.MethodPost, "/login", "", map[string]any{"user_id": id, "password": "password"}, &login)
+	return id, login.Token
+}
+
+type testNotification struct {
+	Kind    string `json:"kind"`
+	ItemID  int64  `json:"item_id"`
+	Message string `json:"message"`
+}
+
+// notifications returns the notifications of the user, the newest first.
+func (s *testServer) notifications(token string) []testNotification {
+	s.t.Helper()
+
+	var res struct {
+		Notifications []testNotification `json:"notifications"`
+	}
+	s.mustDo(http.MethodGet, "/notifications", token, nil, &res)
+	return res.Notifications
+}
+
+// pngHeader is enough of a PNG for the type to be detected.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// multipartRequest builds a multipart form of the fields and the file, which is left out when it is nil.
+func (s *testServer) multipartRequest(method, path string, fields map[string]string, fileField string, file []byte) *http.Request {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	if file != nil {
+		f, err := w.CreateFormFile(fileField, "file")
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		f.Write(file)
+	}
+	w.Close()
+
+	req, err := http.NewRequest(method, s.url+path, &body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+// sell lists an item of the seller and puts it on sale.
+func (s *testServer) sell(token, name string, price int64) int64 {
+	s.t.Helper()
+	return s.sellIn(token, name, 1, price)
+}
+
+// sellIn is sell in the category.
+func (s *testServer) sellIn(token, name string, categoryID, price int64) int64 {
+	s.t.Helper()
+
+	req := s.multipartRequest(http.MethodPost, "/items", map[string]string{
+		"name":        name,
+		"category_id": fmt.Sprint(categoryID),
+		"price":       fmt.Sprint(price),
+		"description": "description of " + name,
+	}, "image", pngHeader)
+	var item struct {
+		ID int64 `json:"id"`
+	}
+	if status := s.send(req, token, &item); status != http.StatusOK {
+		s.t.Fatalf("POST /items: status %d", status)
+	}
+
+	s.mustDo(http.MethodPost, "/sell", token, map[string]int64{"item_id": item.ID}, nil)
+	return item.ID
+}
+
+// eventually retries cond until it holds, for the work done by the event bus after a request.
+func (s *testServer) eventually(what string, cond func() bool) {
+	s.t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	s.t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestLoginThrottleConcurrent(t *testing.T) {
+	s := newTestServer(t)
+	id, _ := s.register("alice")
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		counts = map[int]int{}
+	)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := s.do(http.MethodPost, "/login", "", map[string]any{"user_id": id, "password": "wrong"}, nil)
+			mu.Lock()
+			counts[status]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// only the free attempts of the account and the one which starts its backoff reach bcrypt
+	if counts[http.StatusUnauthorized] > 4 || counts[http.StatusTooManyRequests] == 0 {
+		t.Errorf("30 parallel wrong passwords got %v, want at most 4 401s and the rest 429", counts)
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		want           string
+	}{
+		{"no trusted proxies", nil, "203.0.113.1:1234", "203.0.113.1"},
+		{"private peer is not trusted by default", nil, "10.0.0.1:1234", "10.0.0.1"},
+		{"trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.1:1234", "198.51.100.7"},
+		{"untrusted peer", []string{"10.0.0.0/8"}, "192.168.0.1:1234", "192.168.0.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.8")
+
+			if got := ipExtractor(tt.trustedProxies)(req); got != tt.want {
+				t.Errorf("client IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
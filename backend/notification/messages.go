@@ -0,0 +1,45 @@
+package notification
+
+import (
+	"fmt"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// SavedSearchMatched tells the owner of the saved search that the item was put on sale.
+func SavedSearchMatched(s domain.SavedSearch, item domain.Item) domain.Notification {
+	msg := fmt.Sprintf("%q matching your saved search was put on sale", item.Name)
+	if s.Query != "" {
+		msg = fmt.Sprintf("%q matching your saved search %q was put on sale", item.Name, s.Query)
+	}
+	return domain.Notification{UserID: s.UserID, Kind: domain.NotificationKindSavedSearch, ItemID: item.ID, Message: msg}
+}
+
+// ItemSold tells the seller that the item was purchased.
+func ItemSold(e domain.ItemSold) domain.Notification {
+	return domain.Notification{
+		UserID:  e.SellerID,
+		Kind:    domain.NotificationKindItemSold,
+		ItemID:  e.ItemID,
+		Message: fmt.Sprintf("%q was purchased. %d was added to your balance", e.Name, e.Price),
+	}
+}
+
+// LikedItemSold tells a user who likes the item that it was purchased.
+func LikedItemSold(userID int64, e domain.ItemSold) domain.Notification {
+	return domain.Notification{
+		UserID:  userID,
+		Kind:    domain.NotificationKindLikedItemSold,
+		ItemID:  e.ItemID,
+		Message: fmt.Sprintf("%q you liked was sold", e.Name),
+	}
+}
+
+// BalanceChanged tells the user that the balance changed by amount.
+func BalanceChanged(userID, amount, balance int64) domain.Notification {
+	return domain.Notification{
+		UserID:  userID,
+		Kind:    domain.NotificationKindBalanceChanged,
+		Message: fmt.Sprintf("Your balance changed by %+d to %d", amount, balance),
+	}
+}
@@ -0,0 +1,107 @@
+// Package notification delivers notifications to users through the channels they chose.
+package notification
+
+import (
+	"context"
+	"log"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/mail"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/realtime"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/worker"
+)
+
+// Service is where the notifications of every kind are published.
+// It stores them in the inboxes right away, pushes them to the connected clients,
+// and mails them in the background (Run), as the users prefer.
+type Service struct {
+	repo   db.NotificationRepository
+	users  db.UserRepository
+	hub    *realtime.Hub
+	mailer mail.Mailer
+	mails  *worker.Queue[mail.Message]
+}
+
+func NewService(repo db.NotificationRepository, users db.UserRepository, hub *realtime.Hub, mailer mail.Mailer) *Service {
+	return &Service{repo: repo, users: users, hub: hub, mailer: mailer, mails: worker.NewQueue[mail.Message]()}
+}
+
+// Publish delivers the notifications according to the preferences of their users.
+func (s *Service) Publish(ctx context.Context, notifications ...domain.Notification) error {
+	var (
+		inbox []domain.Notification
+		mails []mail.Message
+	)
+	prefs := map[int64]map[domain.NotificationKind]domain.NotificationPreference{}
+	for _, n := range notifications {
+		userPrefs, ok := prefs[n.UserID]
+		if !ok {
+			list, err := s.Preferences(ctx, n.UserID)
+			if err != nil {
+				return err
+			}
+			userPrefs = make(map[domain.NotificationKind]domain.NotificationPreference, len(list))
+			for _, pref := range list {
+				userPrefs[pref.Kind] = pref
+			}
+			prefs[n.UserID] = userPrefs
+		}
+
+		pref := userPrefs[n.Kind]
+		if pref.Inbox {
+			inbox = append(inbox, n)
+		}
+		if pref.Email {
+			user, err := s.users.GetUser(ctx, n.UserID)
+			if err != nil {
+				return err
+			}
+			if user.Email != "" {
+				mails = append(mails, mail.Message{To: user.Email, Subject: "Notification", Body: "Hello " + user.Name + ",\n\n" + n.Message + "\n"})
+			}
+		}
+	}
+
+	if len(inbox) > 0 {
+		added, err := s.repo.AddNotifications(ctx, inbox)
+		if err != nil {
+			return err
+		}
+		for _, n := range added {
+			s.hub.Publish(realtime.NotificationAdded(n))
+		}
+	}
+	for _, m := range mails {
+		s.mails.Push(m)
+	}
+	return nil
+}
+
+// Preferences returns the preference of every kind for the user.
+func (s *Service) Preferences(ctx context.Context, userID int64) ([]domain.NotificationPreference, error) {
+	changed, err := s.repo.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := make([]domain.NotificationPreference, len(domain.NotificationKinds))
+	for i, kind := range domain.NotificationKinds {
+		prefs[i] = domain.DefaultNotificationPreference(userID, kind)
+		for _, pref := range changed {
+			if pref.Kind == kind {
+				prefs[i] = pref
+			}
+		}
+	}
+	return prefs, nil
+}
+
+// Run sends the queued mails until ctx is done. The mails still queued then are sent before it returns.
+func (s *Service) Run(ctx context.Context) {
+	s.mails.Run(ctx, func(ctx context.Context, m mail.Message) {
+		if err := s.mailer.Send(ctx, m); err != nil {
+			log.Printf("failed to mail a notification: %s", err)
+		}
+	})
+}
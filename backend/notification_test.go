@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+	_, bob := s.register("bob")
+
+	type preference struct {
+		Kind  string `json:"kind"`
+		Inbox bool   `json:"inbox"`
+		Email bool   `json:"email"`
+	}
+	for name, token := range map[string]string{"alice": alice, "bob": bob} {
+		req := s.multipartRequest(http.MethodPut, "/users/me", map[string]string{"name": name, "email": name + "@example.com"}, "", nil)
+		if status := s.send(req, token, nil); status != http.StatusOK {
+			t.Fatalf("PUT /users/me: status %d", status)
+		}
+		s.mustDo(http.MethodPut, "/notifications/preferences", token, []preference{{"balance_changed", true, true}}, nil)
+	}
+	mailsTo := func(to string) int {
+		n := 0
+		for _, m := range s.mails.Sent() {
+			if m.To == to {
+				n++
+			}
+		}
+		return n
+	}
+
+	type notifications struct {
+		UnreadCount   int64 `json:"unread_count"`
+		Notifications []struct {
+			ID   int64 `json:"id"`
+			Read bool  `json:"read"`
+		} `json:"notifications"`
+	}
+	get := func(token string) notifications {
+		t.Helper()
+		var res notifications
+		s.mustDo(http.MethodGet, "/notifications", token, nil, &res)
+		return res
+	}
+
+	for i := 0; i < 3; i++ {
+		s.mustDo(http.MethodPost, "/balance", alice, map[string]int64{"balance": 100}, nil)
+	}
+	s.mustDo(http.MethodPost, "/balance", bob, map[string]int64{"balance": 100}, nil)
+	s.eventually("the notifications and mails of the top-ups", func() bool {
+		return len(get(alice).Notifications) == 3 && mailsTo("alice@example.com") == 3 && mailsTo("bob@example.com") == 1
+	})
+
+	res := get(alice)
+	if res.UnreadCount != 3 {
+		t.Errorf("unread count = %d, want 3", res.UnreadCount)
+	}
+	bobID := get(bob).Notifications[0].ID
+
+	var read struct {
+		UnreadCount int64 `json:"unread_count"`
+	}
+	// the notifications of other users are left alone
+	s.mustDo(http.MethodPost, "/notifications/read", alice, map[string][]int64{"ids": {res.Notifications[0].ID, bobID}}, &read)
+	if read.UnreadCount != 2 {
+		t.Errorf("unread count after reading one = %d, want 2", read.UnreadCount)
+	}
+	if got := get(alice); !got.Notifications[0].Read || got.Notifications[1].Read {
+		t.Errorf("notifications after reading the first one = %+v", got.Notifications)
+	}
+	if got := get(bob).UnreadCount; got != 1 {
+		t.Errorf("unread count of bob after alice read his notification = %d, want 1", got)
+	}
+	// no ids marks all of them
+	s.mustDo(http.MethodPost, "/notifications/read", alice, map[string][]int64{}, &read)
+	if read.UnreadCount != 0 || get(alice).UnreadCount != 0 {
+		t.Errorf("unread count after reading all = %d, want 0", read.UnreadCount)
+	}
+
+	if status := s.do(http.MethodPut, "/notifications/preferences", alice, []preference{{"spam", true, true}}, nil); status != http.StatusBadRequest {
+		t.Errorf("preference of an unknown kind: status %d, want 400", status)
+	}
+	var prefs []preference
+	s.mustDo(http.MethodPut, "/notifications/preferences", alice, []preference{{"balance_changed", false, false}}, &prefs)
+	for _, pref := range prefs {
+		// the other kinds keep the defaults
+		want := preference{pref.Kind, true, false}
+		if pref.Kind == "balance_changed" {
+			want = preference{pref.Kind, false, false}
+		}
+		if pref != want {
+			t.Errorf("preference = %+v, want %+v", pref, want)
+		}
+	}
+
+	// the top-ups are notified in order, so once the one of bob arrived the one of alice was handled
+	s.mustDo(http.MethodPost, "/balance", alice, map[string]int64{"balance": 100}, nil)
+	s.mustDo(http.MethodPost, "/balance", bob, map[string]int64{"balance": 100}, nil)
+	s.eventually("the mail of bob", func() bool {
+		return mailsTo("bob@example.com") == 2
+	})
+	if n := len(get(alice).Notifications); n != 3 {
+		t.Errorf("alice has %d notifications after turning off the inbox, want 3", n)
+	}
+	if n := mailsTo("alice@example.com"); n != 3 {
+		t.Errorf("alice got %d mails after turning off the mails, want 3", n)
+	}
+}
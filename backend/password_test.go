@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+var resetTokenPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+func TestPasswordReset(t *testing.T) {
+	s := newTestServer(t)
+	id, token := s.register("alice")
+	_, bob := s.register("bob")
+	for name, token := range map[string]string{"alice": token, "bob": bob} {
+		req := s.multipartRequest(http.MethodPut, "/users/me", map[string]string{"name": name, "email": name + "@example.com"}, "", nil)
+		if status := s.send(req, token, nil); status != http.StatusOK {
+			t.Fatalf("PUT /users/me of %s: status %d", name, status)
+		}
+	}
+
+	request := func(email string) int {
+		return s.do(http.MethodPost, "/password-reset/request", "", map[string]string{"email": email}, nil)
+	}
+	// an unknown email gets the same response and no mail, and a second request gets no mail while the first token is live
+	for _, email := range []string{"nobody@example.com", "alice@example.com", "alice@example.com", "bob@example.com"} {
+		if status := request(email); status != http.StatusOK {
+			t.Errorf("reset request for %s: status %d, want 200", email, status)
+		}
+	}
+	// the requests are handled in order, so the one of bob comes last
+	s.eventually("the reset mails", func() bool {
+		mails := s.mails.Sent()
+		return len(mails) > 0 && mails[len(mails)-1].To == "bob@example.com"
+	})
+	mails := s.mails.Sent()
+	if len(mails) != 2 || mails[0].To != "alice@example.com" {
+		t.Fatalf("reset mails = %+v", mails)
+	}
+	resetToken := resetTokenPattern.FindString(mails[0].Body)
+
+	confirm := func(token string) int {
+		return s.do(http.MethodPost, "/password-reset/confirm", "", map[string]string{"token": token, "new_password": "new password"}, nil)
+	}
+	if status := confirm(resetToken); status != http.StatusOK {
+		t.Fatalf("reset: status %d", status)
+	}
+	if status := confirm(resetToken); status != http.StatusPreconditionFailed {
+		t.Errorf("token used twice: status %d, want 412", status)
+	}
+	s.mustDo(http.MethodPost, "/login", "", map[string]any{"user_id": id, "password": "new password"}, nil)
+
+	// once the token is used, the next request is mailed a new one
+	if status := request("alice@example.com"); status != http.StatusOK {
+		t.Fatalf("reset request after the reset: status %d", status)
+	}
+	s.eventually("the second reset mail of alice", func() bool {
+		return len(s.mails.Sent()) == 3
+	})
+
+	// the requests for an email are throttled in any case of it, after 3 free ones and one more right after them
+	if status := request("Alice@example.com"); status != http.StatusOK {
+		t.Errorf("fourth reset request: status %d, want 200", status)
+	}
+	if status := request("ALICE@example.com"); status != http.StatusTooManyRequests {
+		t.Errorf("fifth reset request: status %d, want 429", status)
+	}
+	if status := request("carol@example.com"); status != http.StatusOK {
+		t.Errorf("reset request for another email: status %d", status)
+	}
+}
+
+func TestChangePasswordThrottle(t *testing.T) {
+	s := newTestServer(t)
+	id, token := s.register("alice")
+
+	change := func(current string) int {
+		return s.do(http.MethodPut, "/users/me/password", token, map[string]string{"current_password": current, "new_password": "new password"}, nil)
+	}
+	// 3 failures are free, the fourth is made right away and sets the delay
+	for i := 0; i < 4; i++ {
+		if status := change("wrong password"); status != http.StatusForbidden {
+			t.Fatalf("wrong current password %d: status %d, want 403", i+1, status)
+		}
+	}
+	// the guesses of the current password count as failed logins of the account
+	if status := change("password"); status != http.StatusTooManyRequests {
+		t.Errorf("change after 4 wrong passwords: status %d, want 429", status)
+	}
+	if status := s.do(http.MethodPost, "/login", "", map[string]any{"user_id": id, "password": "password"}, nil); status != http.StatusTooManyRequests {
+		t.Errorf("login after 4 wrong passwords: status %d, want 429", status)
+	}
+}
@@ -0,0 +1,130 @@
+// Package policy decides what an authenticated user is allowed to do.
+// Handlers build a Subject from the user row and ask the policy before touching the repositories.
+package policy
+
+import (
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type Subject struct {
+	UserID int64
+	Role   domain.Role
+}
+
+func (s Subject) IsAdmin() bool {
+	return s.Role == domain.RoleAdmin
+}
+
+func (s Subject) Owns(item domain.Item) bool {
+	return s.UserID == item.UserID
+}
+
+// CanManageItem allows only the seller of the item (or an admin, for moderation) to change it.
+func CanManageItem(s Subject, item domain.Item) error {
+	if s.Owns(item) || s.IsAdmin() {
+		return nil
+	}
+	return domain.NewForbiddenError("item is owned by another user")
+}
+
+// CanSell allows the seller to put an item on sale only while it is still a draft.
+// Admins can't sell the items of other users, as the sale would be made in the name of the seller.
+func CanSell(s Subject, item domain.Item) error {
+	if !s.Owns(item) {
+		return domain.NewForbiddenError("item is owned by another user")
+	}
+	if item.Status != domain.ItemStatusInitial {
+		return domain.NewPreconditionFailedError("item is not a draft")
+	}
+	return nil
+}
+
+// CanPurchase allows buying items of other users which are on sale.
+func CanPurchase(s Subject, item domain.Item) error {
+	if s.Owns(item) {
+		return domain.NewPreconditionFailedError("cannot purchase own item")
+	}
+	if item.Status != domain.ItemStatusOnSale {
+		return domain.NewPreconditionFailedError("item is not on sale")
+	}
+	return nil
+}
+
+// ItemView is the set of items a subject may see in a list of somebody's items.
+type ItemView int
+
+const (
+	// ItemViewPublic shows only items that have been put on sale.
+	ItemViewPublic ItemView = iota + 1
+	// ItemViewOwner additionally shows drafts.
+	ItemViewOwner
+)
+
+// UserItemsView returns the view of the items listed by ownerID.
+func UserItemsView(s Subject, ownerID int64) ItemView {
+	if s.UserID == ownerID || s.IsAdmin() {
+		return ItemViewOwner
+	}
+	return ItemViewPublic
+}
+
+func (v ItemView) Visible(item domain.Item) bool {
+	if v == ItemViewOwner {
+		return true
+	}
+	return PublicStatus(item.Status)
+}
+
+// PublicStatus reports whether items in the status may be shown to anyone.
+func PublicStatus(status domain.ItemStatus) bool {
+	return status == domain.ItemStatusOnSale || status == domain.ItemStatusSoldOut
+}
+
+// CanAdminister allows only admins to use the moderation API.
+func CanAdminister(s Subject) error {
+	if !s.IsAdmin() {
+		return domain.NewForbiddenError("admin role is required")
+	}
+	return nil
+}
+
+// CanUseAccount rejects suspended users.
+func CanUseAccount(user domain.User) error {
+	if user.Suspended {
+		return domain.NewForbiddenError("account is suspended")
+	}
+	return nil
+}
+
+// CanLike allows liking items of other users which are shown to anyone.
+func CanLike(s Subject, item domain.Item) error {
+	if s.Owns(item) {
+		return domain.NewPreconditionFailedError("cannot like own item")
+	}
+	if !PublicStatus(item.Status) {
+		return domain.NewPreconditionFailedError("item is not on sale")
+	}
+	return nil
+}
+
+// CanComment allows anyone to comment on items on sale. Comments are closed once the item is sold.
+func CanComment(s Subject, item domain.Item) error {
+	if item.Status == domain.ItemStatusSoldOut {
+		return domain.NewPreconditionFailedError("comments are closed")
+	}
+	if item.Status != domain.ItemStatusOnSale {
+		return domain.NewPreconditionFailedError("item is not on sale")
+	}
+	return nil
+}
+
+// CanReport allows reporting items of other users which are on sale.
+func CanReport(s Subject, item domain.Item) error {
+	if s.Owns(item) {
+		return domain.NewPreconditionFailedError("cannot report own item")
+	}
+	if item.Status != domain.ItemStatusOnSale {
+		return domain.NewPreconditionFailedError("item is not on sale")
+	}
+	return nil
+}
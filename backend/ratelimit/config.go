@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rule allows Requests requests per Per with bursts up to Burst.
+// Method and Path select a route, using the path pattern it is registered with, e.g. "/items/:itemID".
+type Rule struct {
+	Method   string        `yaml:"method,omitempty"`
+	Path     string        `yaml:"path,omitempty"`
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+func (r Rule) rate() float64 {
+	return float64(r.Requests) / r.Per.Seconds()
+}
+
+func (r Rule) validate() error {
+	if r.Requests <= 0 || r.Per <= 0 || r.Burst <= 0 {
+		return fmt.Errorf("requests, per and burst must be positive: %s %s", r.Method, r.Path)
+	}
+	return nil
+}
+
+// Config has the default rule of each scope and the rules of individual routes, which take precedence.
+type Config struct {
+	Public        Rule   `yaml:"public"`
+	Authenticated Rule   `yaml:"authenticated"`
+	Routes        []Rule `yaml:"routes"`
+}
+
+// DefaultConfig is used when the config file has no rate limit.
+func DefaultConfig() Config {
+	return Config{
+		Public:        Rule{Requests: 100, Per: time.Second, Burst: 200},
+		Authenticated: Rule{Requests: 20, Per: time.Second, Burst: 40},
+		Routes: []Rule{
+			{Method: "POST", Path: "/items", Requests: 30, Per: time.Minute, Burst: 10},
+			{Method: "POST", Path: "/balance", Requests: 30, Per: time.Minute, Burst: 10},
+			{Method: "POST", Path: "/register", Requests: 10, Per: time.Second, Burst: 50},
+			{Method: "POST", Path: "/items/:itemID/comments", Requests: 30, Per: time.Minute, Burst: 10},
+		},
+	}
+}
+
+func (c Config) Validate() error {
+	for _, r := range append([]Rule{c.Public, c.Authenticated}, c.Routes...) {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if r.Path != "" && r.Method == "" {
+			return fmt.Errorf("method is required: %s", r.Path)
+		}
+	}
+	return nil
+}
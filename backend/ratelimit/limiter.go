@@ -0,0 +1,90 @@
+// Package ratelimit limits requests with token buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the number of requests between removals of idle buckets.
+const sweepInterval = 4096
+
+// Limiter holds a token bucket per key. Buckets start full with Burst tokens and refill at Rate tokens per second.
+type Limiter struct {
+	Rate  float64
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Result is the state of the bucket after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until the next token is available. It is zero when Remaining > 0.
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from the bucket of key if there is one.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%sweepInterval == 0 {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	res := Result{Limit: l.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	}
+	res.Remaining = int(b.tokens)
+	if b.tokens < 1 {
+		res.RetryAfter = l.duration(1 - b.tokens)
+	}
+	res.Reset = l.duration(float64(l.Burst) - b.tokens)
+	return res
+}
+
+func (l *Limiter) duration(tokens float64) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
+
+// sweep drops buckets which have refilled completely since they were last used.
+func (l *Limiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= float64(l.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter whose clock only moves with the returned func.
+func newTestLimiter(rate float64, burst int) (*Limiter, func(time.Duration)) {
+	l := NewLimiter(rate, burst)
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	// 2 tokens per second, up to 4
+	l, advance := newTestLimiter(2, 4)
+
+	for i := 3; i >= 0; i-- {
+		res := l.Allow("a")
+		if !res.Allowed || res.Remaining != i || res.Limit != 4 {
+			t.Fatalf("request %d of the burst = %+v", 4-i, res)
+		}
+	}
+	res := l.Allow("a")
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request after the burst = %+v", res)
+	}
+	if res.RetryAfter != 500*time.Millisecond || res.Reset != 2*time.Second {
+		t.Errorf("RetryAfter = %s, Reset = %s, want 500ms and 2s", res.RetryAfter, res.Reset)
+	}
+
+	// another key has its own bucket
+	if res := l.Allow("b"); !res.Allowed {
+		t.Errorf("first request of another key = %+v", res)
+	}
+
+	advance(500 * time.Millisecond)
+	if res := l.Allow("a"); !res.Allowed {
+		t.Fatalf("request after a token was refilled = %+v", res)
+	}
+	if res := l.Allow("a"); res.Allowed {
+		t.Fatalf("second request after one token was refilled = %+v", res)
+	}
+
+	// the bucket refills up to the burst only
+	advance(time.Hour)
+	for i := 0; i < 4; i++ {
+		if res := l.Allow("a"); !res.Allowed {
+			t.Fatalf("request %d after a long idle time = %+v", i+1, res)
+		}
+	}
+	if res := l.Allow("a"); res.Allowed {
+		t.Errorf("more than the burst after a long idle time: %+v", res)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l, advance := newTestLimiter(1, 1)
+	l.Allow("idle")
+	advance(time.Second)
+	for i := 0; i < sweepInterval; i++ {
+		l.Allow("busy")
+	}
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("the bucket of an idle key which refilled was kept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("the bucket of a busy key was dropped")
+	}
+}
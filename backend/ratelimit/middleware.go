@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Scope int
+
+const (
+	ScopePublic Scope = iota + 1
+	ScopeAuthenticated
+)
+
+// KeyFunc identifies the client of a request, e.g. by IP or by user ID.
+type KeyFunc func(c echo.Context) string
+
+// Limiters holds a limiter per scope and per configured route.
+type Limiters struct {
+	scopes map[Scope]*Limiter
+	routes map[string]*Limiter
+}
+
+func New(cfg Config) *Limiters {
+	l := &Limiters{
+		scopes: map[Scope]*Limiter{
+			ScopePublic:        NewLimiter(cfg.Public.rate(), cfg.Public.Burst),
+			ScopeAuthenticated: NewLimiter(cfg.Authenticated.rate(), cfg.Authenticated.Burst),
+		},
+		routes: make(map[string]*Limiter, len(cfg.Routes)),
+	}
+	for _, r := range cfg.Routes {
+		l.routes[r.Method+" "+r.Path] = NewLimiter(r.rate(), r.Burst)
+	}
+	return l
+}
+
+// Middleware limits the requests of a route group. It uses the rule of the matched route if there is one, otherwise the one of scope.
+// Responses have X-RateLimit-* headers, and rejected requests get 429 with Retry-After.
+func (l *Limiters) Middleware(scope Scope, key KeyFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// routes without their own rule share the buckets of the scope
+			limiter, ok := l.routes[c.Request().Method+" "+c.Path()]
+			if !ok {
+				limiter = l.scopes[scope]
+			}
+
+			res := limiter.Allow(key(c))
+
+			h := c.Response().Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("X-RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// KeyByIP is the KeyFunc for public routes.
+func KeyByIP(c echo.Context) string {
+	return c.RealIP()
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
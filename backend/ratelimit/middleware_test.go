@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var testConfig = Config{
+	Public:        Rule{Requests: 1, Per: time.Hour, Burst: 3},
+	Authenticated: Rule{Requests: 1, Per: time.Hour, Burst: 3},
+	Routes: []Rule{
+		{Method: http.MethodPost, Path: "/items/:itemID/comments", Requests: 1, Per: time.Hour, Burst: 1},
+	},
+}
+
+func newTestEcho(cfg Config) *echo.Echo {
+	e := echo.New()
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false), echo.TrustIPRange(proxies))
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	g := e.Group("", New(cfg).Middleware(ScopePublic, KeyByIP))
+	g.GET("/items", ok)
+	g.GET("/items/:itemID", ok)
+	g.POST("/items/:itemID/comments", ok)
+	return e
+}
+
+// request sends a request from the client IP through the trusted proxy 10.0.0.1.
+func request(e *echo.Echo, method, path, clientIP string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, clientIP)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	e := newTestEcho(testConfig)
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		rec := request(e, http.MethodGet, "/items", "203.0.113.1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, rec.Code)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != "3" {
+			t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != remaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, remaining)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "" {
+			t.Errorf("request %d: Retry-After = %q on an allowed request", i+1, got)
+		}
+	}
+
+	rec := request(e, http.MethodGet, "/items", "203.0.113.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request after the burst: status %d, want 429", rec.Code)
+	}
+	// a token per hour
+	if got := rec.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != "10800" {
+		t.Errorf("X-RateLimit-Reset = %q, want 10800", got)
+	}
+}
+
+func TestMiddlewareRules(t *testing.T) {
+	e := newTestEcho(testConfig)
+
+	// the route rule has its own bucket of 1, matched by the path pattern of the route
+	if rec := request(e, http.MethodPost, "/items/1/comments", "203.0.113.1"); rec.Code != http.StatusOK {
+		t.Fatalf("first comment: status %d", rec.Code)
+	}
+	if rec := request(e, http.MethodPost, "/items/2/comments", "203.0.113.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second comment: status %d, want 429", rec.Code)
+	}
+	if got := request(e, http.MethodPost, "/items/2/comments", "203.0.113.1").Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("X-RateLimit-Limit of the route = %q, want 1", got)
+	}
+
+	// the other routes of the scope share its bucket, which the route rule didn't take from
+	for i := 0; i < 3; i++ {
+		path := []string{"/items", "/items/1", "/items/2"}[i]
+		if rec := request(e, http.MethodGet, path, "203.0.113.1"); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, rec.Code)
+		}
+	}
+	if rec := request(e, http.MethodGet, "/items/3", "203.0.113.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request over the scope burst: status %d, want 429", rec.Code)
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	e := newTestEcho(testConfig)
+
+	for i := 0; i < 3; i++ {
+		request(e, http.MethodGet, "/items", "203.0.113.1")
+	}
+	if rec := request(e, http.MethodGet, "/items", "203.0.113.1"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	// behind the trusted proxy every client has its own bucket
+	if rec := request(e, http.MethodGet, "/items", "203.0.113.2"); rec.Code != http.StatusOK {
+		t.Errorf("another client behind the proxy: status %d", rec.Code)
+	}
+
+	// a peer which isn't trusted can't pick its bucket with the header
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	for i := 0; i < 4; i++ {
+		req.Header.Set(echo.HeaderXForwardedFor, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}[i])
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if want := []int{200, 200, 200, 429}[i]; rec.Code != want {
+			t.Errorf("request %d from an untrusted peer: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("the default config is invalid: %s", err)
+	}
+	for name, cfg := range map[string]Config{
+		"zero requests":        {Public: Rule{Per: time.Second, Burst: 1}, Authenticated: testConfig.Authenticated},
+		"zero burst":           {Public: testConfig.Public, Authenticated: Rule{Requests: 1, Per: time.Second}},
+		"route without method": {Public: testConfig.Public, Authenticated: testConfig.Authenticated, Routes: []Rule{{Path: "/items", Requests: 1, Per: time.Second, Burst: 1}}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/ratelimit"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"127.0.0.0/8"}
+		cfg.RateLimit.Public = ratelimit.Rule{Requests: 1, Per: time.Hour, Burst: 4}
+		cfg.RateLimit.Authenticated = ratelimit.Rule{Requests: 1, Per: time.Hour, Burst: 2}
+	})
+	// the registrations and logins come from 127.0.0.1, which has a bucket of its own
+	_, alice := s.register("alice")
+	_, bob := s.register("bob")
+
+	get := func(path, token, forwardedFor string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		return s.send(req, token, nil)
+	}
+
+	// the logged in users are keyed by their ID, wherever they come from
+	for i, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		if code := get("/balance", alice, forwardedFor); code != http.StatusOK {
+			t.Fatalf("request %d of alice: status %d", i+1, code)
+		}
+	}
+	if code := get("/balance", alice, "203.0.113.3"); code != http.StatusTooManyRequests {
+		t.Errorf("request of alice over the burst: status %d, want 429", code)
+	}
+	if code := get("/balance", bob, "203.0.113.1"); code != http.StatusOK {
+		t.Errorf("request of bob from the address of alice: status %d", code)
+	}
+
+	// the other requests are keyed by the client address the trusted proxy forwarded
+	for i := 0; i < 4; i++ {
+		if code := get("/items", "", "203.0.113.1"); code != http.StatusOK {
+			t.Fatalf("public request %d: status %d", i+1, code)
+		}
+	}
+	if code := get("/items", "", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("public request over the burst: status %d, want 429", code)
+	}
+	if code := get("/items", "", "203.0.113.2"); code != http.StatusOK {
+		t.Errorf("public request of another client behind the proxy: status %d", code)
+	}
+}
@@ -0,0 +1,145 @@
+// Package realtime pushes changes to the clients connected to GET /events.
+package realtime
+
+import (
+	"sync"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type EventType string
+
+const (
+	// EventItem is sent to everyone when the status of an item changes.
+	EventItem EventType = "item"
+	// EventBalance is sent to a user whose balance changed.
+	EventBalance EventType = "balance"
+	// EventNotification is sent to a user who got a notification in the inbox.
+	EventNotification EventType = "notification"
+)
+
+// Event is sent to the subscriptions of UserID, or to every subscription when UserID is 0.
+type Event struct {
+	Type   EventType
+	UserID int64
+	// Data is sent as JSON.
+	Data any
+}
+
+type itemData struct {
+	ID     int64             `json:"id"`
+	Status domain.ItemStatus `json:"status"`
+}
+
+type balanceData struct {
+	Balance int64 `json:"balance"`
+}
+
+type notificationData struct {
+	ID        int64                   `json:"id"`
+	Kind      domain.NotificationKind `json:"kind"`
+	ItemID    int64                   `json:"item_id,omitempty"`
+	Message   string                  `json:"message"`
+	CreatedAt string                  `json:"created_at"`
+}
+
+func ItemStatusChanged(itemID int64, status domain.ItemStatus) Event {
+	return Event{Type: EventItem, Data: itemData{ID: itemID, Status: status}}
+}
+
+func BalanceChanged(userID, balance int64) Event {
+	return Event{Type: EventBalance, UserID: userID, Data: balanceData{Balance: balance}}
+}
+
+func NotificationAdded(n domain.Notification) Event {
+	return Event{Type: EventNotification, UserID: n.UserID, Data: notificationData{
+		ID:        n.ID,
+		Kind:      n.Kind,
+		ItemID:    n.ItemID,
+		Message:   n.Message,
+		CreatedAt: n.CreatedAt,
+	}}
+}
+
+// subscriptionBuffer is the number of events a subscription can fall behind before it is closed.
+const subscriptionBuffer = 32
+
+// Subscription receives the events of a user and the events for everyone.
+type Subscription struct {
+	hub    *Hub
+	userID int64
+	events chan Event
+}
+
+// Events is closed when the subscription is closed, by Close, by the hub shutting down or by falling behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub is the in-process pub/sub of the events. Publish never blocks: a subscription which doesn't keep up is closed
+// and its client is expected to reconnect and load the current state again.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[*Subscription]struct{}{}}
+}
+
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	s := &Subscription{hub: h, userID: userID, events: make(chan Event, subscriptionBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.events)
+		return s
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+func (h *Hub) Publish(events ...Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range events {
+		for s := range h.subs {
+			if e.UserID != 0 && e.UserID != s.userID {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				h.remove(s)
+			}
+		}
+	}
+}
+
+// Close closes every subscription, and the ones made later, so that the streams end before the server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s)
+	}
+}
+
+// remove closes the subscription unless it is closed already. h.mu must be locked.
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.events)
+	}
+}
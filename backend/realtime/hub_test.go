@@ -0,0 +1,110 @@
+package realtime
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// received drains the events the subscription has buffered and reports whether it is still open.
+func received(s *Subscription) (events []Event, open bool) {
+	for {
+		select {
+		case e, ok := <-s.Events():
+			if !ok {
+				return events, false
+			}
+			events = append(events, e)
+		default:
+			return events, true
+		}
+	}
+}
+
+func TestHubFanOut(t *testing.T) {
+	h := NewHub()
+	alice1, alice2, bob := h.Subscribe(1), h.Subscribe(1), h.Subscribe(2)
+
+	h.Publish(BalanceChanged(1, 100), ItemStatusChanged(10, domain.ItemStatusSoldOut))
+
+	for _, tt := range []struct {
+		name  string
+		sub   *Subscription
+		types []EventType
+	}{
+		// every subscription of the user gets the events of the user
+		{"first tab of alice", alice1, []EventType{EventBalance, EventItem}},
+		{"second tab of alice", alice2, []EventType{EventBalance, EventItem}},
+		// and the other users only the ones for everyone
+		{"bob", bob, []EventType{EventItem}},
+	} {
+		events, open := received(tt.sub)
+		if !open {
+			t.Errorf("%s: subscription closed", tt.name)
+		}
+		var types []EventType
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		if !reflect.DeepEqual(types, tt.types) {
+			t.Errorf("%s: got %v, want %v", tt.name, types, tt.types)
+		}
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	h := NewHub()
+	alice, bob := h.Subscribe(1), h.Subscribe(2)
+
+	alice.Close()
+	// closing twice, as the handler does after the hub closed it, is fine
+	alice.Close()
+	if _, open := received(alice); open {
+		t.Error("the events of a closed subscription are still open")
+	}
+	if _, ok := h.subs[alice]; ok || len(h.subs) != 1 {
+		t.Errorf("%d subscriptions left after closing one of 2", len(h.subs))
+	}
+
+	h.Publish(ItemStatusChanged(10, domain.ItemStatusSoldOut))
+	if events, _ := received(bob); len(events) != 1 {
+		t.Errorf("the other subscription got %d events, want 1", len(events))
+	}
+}
+
+func TestSubscriptionFallingBehind(t *testing.T) {
+	h := NewHub()
+	slow, fast := h.Subscribe(1), h.Subscribe(2)
+
+	for i := 0; i < subscriptionBuffer; i++ {
+		h.Publish(BalanceChanged(1, int64(i)))
+	}
+	if _, ok := h.subs[slow]; !ok {
+		t.Fatal("a subscription with a full buffer was closed before it fell behind")
+	}
+	// publishing never blocks: the subscription is closed once it can't take more
+	h.Publish(BalanceChanged(1, subscriptionBuffer))
+	events, open := received(slow)
+	if open || len(events) != subscriptionBuffer {
+		t.Errorf("slow subscription: %d events, open %v, want the %d buffered ones and closed", len(events), open, subscriptionBuffer)
+	}
+	if _, open := received(fast); !open {
+		t.Error("a subscription which kept up was closed")
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub()
+	before := h.Subscribe(1)
+	h.Close()
+	after := h.Subscribe(1)
+
+	for name, s := range map[string]*Subscription{"before": before, "after": after} {
+		if _, open := received(s); open {
+			t.Errorf("subscription made %s closing the hub is open", name)
+		}
+	}
+	// nothing is sent to closed subscriptions
+	h.Publish(BalanceChanged(1, 100))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
+)
+
+func TestReportHidesItem(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.registerAdmin("admin")
+	_, seller := s.register("alice")
+	id := s.sell(seller, "leather jacket", 500)
+
+	var reporters []string
+	for i := 0; i < 6; i++ {
+		_, token := s.register(fmt.Sprintf("reporter%d", i))
+		reporters = append(reporters, token)
+	}
+	report := func(token string) int {
+		return s.do(http.MethodPost, fmt.Sprintf("/items/%d/reports", id), token, map[string]string{"reason": "fraud"}, nil)
+	}
+	// read through the item cache
+	hidden := func() bool {
+		var item struct {
+			Status int `json:"status"`
+		}
+		s.mustDo(http.MethodGet, fmt.Sprintf("/items/%d", id), "", nil, &item)
+		return item.Status == 5
+	}
+	searchHits := func() int {
+		var items []struct{}
+		s.mustDo(http.MethodGet, "/search?name=jacket", "", nil, &items)
+		return len(items)
+	}
+
+	// the reports are counted in their transaction, so exactly the third one hides the item
+	var wg sync.WaitGroup
+	for _, token := range reporters[:3] {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			if code := report(token); code != http.StatusOK {
+				t.Errorf("report: status %d", code)
+			}
+		}(token)
+	}
+	wg.Wait()
+	if !hidden() {
+		t.Fatal("the item is not hidden after 3 reports")
+	}
+	if n := searchHits(); n != 0 {
+		t.Errorf("%d search hits for a hidden item", n)
+	}
+
+	s.mustDo(http.MethodPost, fmt.Sprintf("/admin/items/%d/restore", id), admin, map[string]string{"reason": "review"}, nil)
+	if hidden() || searchHits() != 1 {
+		t.Fatal("the item is not on sale after the restore")
+	}
+
+	// the reports before the review are resolved
+	if code := report(reporters[3]); code != http.StatusOK {
+		t.Fatalf("report after the restore: status %d", code)
+	}
+	if hidden() {
+		t.Error("one report after the restore hid the item again")
+	}
+	if code := report(reporters[0]); code != http.StatusConflict {
+		t.Errorf("second report of the same user: status %d, want 409", code)
+	}
+
+	for _, token := range reporters[4:] {
+		if code := report(token); code != http.StatusOK {
+			t.Fatalf("report: status %d", code)
+		}
+	}
+	if !hidden() {
+		t.Error("the item is not hidden after 3 reports since the restore")
+	}
+}
+
+func TestReportLimit(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Report.Limit = 2
+	})
+	_, seller := s.register("alice")
+	_, reporter := s.register("bob")
+	var items []int64
+	for i := 0; i < 5; i++ {
+		items = append(items, s.sell(seller, fmt.Sprintf("item %d", i), 100))
+	}
+
+	// the reports of the user are counted in the transaction of the report, so concurrent ones can't all pass the limit
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = map[int]int{}
+	)
+	for _, id := range items {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			code := s.do(http.MethodPost, fmt.Sprintf("/items/%d/reports", id), reporter, map[string]string{"reason": "fraud"}, nil)
+			mu.Lock()
+			defer mu.Unlock()
+			codes[code]++
+		}(id)
+	}
+	wg.Wait()
+	if codes[http.StatusOK] != 2 || codes[http.StatusTooManyRequests] != 3 {
+		t.Errorf("statuses of 5 concurrent reports with a limit of 2 = %v", codes)
+	}
+
+	var reports int
+	if err := s.db.Read.QueryRow("SELECT COUNT(*) FROM reports").Scan(&reports); err != nil {
+		t.Fatal(err)
+	}
+	if reports != 2 {
+		t.Errorf("%d reports stored, want 2", reports)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type testSavedSearch struct {
+	ID          int64   `json:"id"`
+	Query       string  `json:"query"`
+	CategoryIDs []int64 `json:"category_ids"`
+	MinPrice    *int64  `json:"min_price"`
+	MaxPrice    *int64  `json:"max_price"`
+}
+
+func TestSavedSearchCRUD(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+	_, bob := s.register("bob")
+
+	for _, tt := range []struct {
+		name string
+		body map[string]any
+		want int
+	}{
+		{"query", map[string]any{"query": "jacket"}, http.StatusOK},
+		{"filter", map[string]any{"category_ids": []int64{2}, "max_price": 1000}, http.StatusOK},
+		{"neither query nor filter", map[string]any{"query": "  "}, http.StatusBadRequest},
+		{"negative price", map[string]any{"query": "jacket", "min_price": -1}, http.StatusBadRequest},
+		{"min over max", map[string]any{"query": "jacket", "min_price": 2000, "max_price": 1000}, http.StatusBadRequest},
+		{"missing category", map[string]any{"category_ids": []int64{12345}}, http.StatusBadRequest},
+	} {
+		if status := s.do(http.MethodPost, "/saved-searches", alice, tt.body, nil); status != tt.want {
+			t.Errorf("add a saved search with %s: status %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	list := func(token string) []testSavedSearch {
+		t.Helper()
+		var res []testSavedSearch
+		s.mustDo(http.MethodGet, "/saved-searches", token, nil, &res)
+		return res
+	}
+	saved := list(alice)
+	if len(saved) != 2 {
+		t.Fatalf("%d saved searches, want 2: %+v", len(saved), saved)
+	}
+	if len(list(bob)) != 0 {
+		t.Error("bob sees the saved searches of alice")
+	}
+
+	// a saved search of another user is not found
+	path := fmt.Sprintf("/saved-searches/%d", saved[0].ID)
+	if status := s.do(http.MethodDelete, path, bob, nil, nil); status != http.StatusNotFound {
+		t.Errorf("bob deleting a saved search of alice: status %d, want 404", status)
+	}
+	s.mustDo(http.MethodDelete, path, alice, nil, nil)
+	if status := s.do(http.MethodDelete, path, alice, nil, nil); status != http.StatusNotFound {
+		t.Errorf("deleting a saved search twice: status %d, want 404", status)
+	}
+	if got := list(alice); len(got) != 1 || got[0].ID != saved[1].ID {
+		t.Errorf("saved searches after the deletion = %+v", got)
+	}
+}
+
+func TestSavedSearchLimit(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.register("alice")
+
+	for i := 0; i < 20; i++ {
+		s.mustDo(http.MethodPost, "/saved-searches", alice, map[string]any{"query": fmt.Sprintf("query %d", i)}, nil)
+	}
+	if status := s.do(http.MethodPost, "/saved-searches", alice, map[string]any{"query": "one too many"}, nil); status != http.StatusPreconditionFailed {
+		t.Errorf("21st saved search: status %d, want 412", status)
+	}
+}
+
+func TestSavedSearchMatch(t *testing.T) {
+	s := newTestServer(t)
+	_, seller := s.register("seller")
+	_, alice := s.register("alice")
+	_, bob := s.register("bob")
+
+	var saved testSavedSearch
+	s.mustDo(http.MethodPost, "/saved-searches", alice, map[string]any{"query": "JACKET", "max_price": 1000}, &saved)
+	s.mustDo(http.MethodPost, "/saved-searches", bob, map[string]any{"category_ids": []int64{2}}, nil)
+	// the own items of the seller don't match
+	s.mustDo(http.MethodPost, "/saved-searches", seller, map[string]any{"query": "jacket"}, nil)
+
+	// the items are matched in the order they were put on sale, so the last one being notified means the others were matched already
+	s.sell(seller, "expensive jacket", 5000)
+	s.sell(seller, "shirt", 500)
+	matching := s.sell(seller, "denim jacket", 800)
+	s.eventually("the notification of the matching item", func() bool {
+		return len(s.notifications(alice)) > 0
+	})
+	got := s.notifications(alice)
+	if len(got) != 1 || got[0].Kind != "saved_search" || got[0].ItemID != matching {
+		t.Errorf("notifications of alice = %+v, want one of the denim jacket", got)
+	}
+	if n := len(s.notifications(seller)); n != 0 {
+		t.Errorf("the seller got %d notifications of their own items", n)
+	}
+
+	// a deleted saved search doesn't match any more
+	s.mustDo(http.MethodDelete, fmt.Sprintf("/saved-searches/%d", saved.ID), alice, nil, nil)
+	book := s.sellIn(seller, "cheap jacket book", 2, 500)
+	s.eventually("the notification of bob", func() bool {
+		return len(s.notifications(bob)) > 0
+	})
+	if got := s.notifications(bob); len(got) != 1 || got[0].ItemID != book {
+		t.Errorf("notifications of bob = %+v, want one of the book", got)
+	}
+	if n := len(s.notifications(alice)); n != 1 {
+		t.Errorf("alice has %d notifications after deleting the saved search, want 1", n)
+	}
+}
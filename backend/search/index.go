@@ -0,0 +1,350 @@
+// Package search keeps the in-memory indexes behind GET /search and GET /search/suggest
+// and matches the items put on sale with the saved searches of users.
+package search
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+type Kind string
+
+const (
+	// KindItem completes the name of items on sale.
+	KindItem Kind = "item"
+	// KindCategory completes a category name.
+	KindCategory Kind = "category"
+	// KindQuery completes a query which found items before, but matches no item name on sale now.
+	KindQuery Kind = "query"
+)
+
+type Suggestion struct {
+	Text string `json:"text"`
+	Kind Kind   `json:"kind"`
+	// Score is the popularity the suggestions are ranked by:
+	// the items on sale with the name or in the category plus the times the text was searched.
+	Score int64 `json:"score"`
+}
+
+type entry struct {
+	// text is shown to users. It is the name of an item for item entries.
+	text     string
+	listings int64
+	searches int64
+}
+
+// document is an item on sale in the inverted index.
+type document struct {
+	// item has no image.
+	item        domain.Item
+	name        string
+	description string
+}
+
+// Index holds two indexes of the items on sale, which are kept up to date together.
+//
+// The inverted index maps the tokens of the normalized names and descriptions to the items, for Search.
+// The prefix index has the names of the items and the recorded search queries, for Suggest.
+// Its keys are normalized texts kept sorted, so that the completions of a prefix are a contiguous range.
+type Index struct {
+	tokenizer Tokenizer
+
+	mu       sync.RWMutex
+	docs     map[int64]*document
+	postings map[string]map[int64]struct{}
+	entries  map[string]*entry
+	keys     []string
+	// categoryListings counts the items on sale per category.
+	categoryListings map[int64]int64
+	// pending are the searches recorded since the last Flush.
+	pending map[string]int64
+}
+
+func NewIndex(tokenizer Tokenizer) *Index {
+	return &Index{
+		tokenizer:        tokenizer,
+		docs:             map[int64]*document{},
+		postings:         map[string]map[int64]struct{}{},
+		entries:          map[string]*entry{},
+		categoryListings: map[int64]int64{},
+		pending:          map[string]int64{},
+	}
+}
+
+// Load replaces the index with the listings and the queries in the DB.
+// Searches not flushed yet are dropped, since Load is also used after /initialize reset the DB.
+func (x *Index) Load(ctx context.Context, repo db.SearchRepository) error {
+	items, err := repo.GetListedItems(ctx)
+	if err != nil {
+		return err
+	}
+	queries, err := repo.GetSearchQueries(ctx)
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.docs = map[int64]*document{}
+	x.postings = map[string]map[int64]struct{}{}
+	x.entries = map[string]*entry{}
+	x.keys = nil
+	x.categoryListings = map[int64]int64{}
+	x.pending = map[string]int64{}
+	for _, item := range items {
+		x.addListing(item)
+	}
+	for _, q := range queries {
+		x.entryOf(q.Query).searches += q.Count
+	}
+	return nil
+}
+
+// AddListing indexes an item which was put on sale.
+func (x *Index) AddListing(item domain.Item) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.addListing(item)
+}
+
+func (x *Index) addListing(item domain.Item) {
+	if _, ok := x.docs[item.ID]; ok {
+		return
+	}
+	item.Image = nil
+	doc := &document{item: item, name: Normalize(item.Name), description: Normalize(item.Description)}
+	x.docs[item.ID] = doc
+	for _, token := range append(x.tokenizer.Tokens(doc.name), x.tokenizer.Tokens(doc.description)...) {
+		ids, ok := x.postings[token]
+		if !ok {
+			ids = map[int64]struct{}{}
+			x.postings[token] = ids
+		}
+		ids[item.ID] = struct{}{}
+	}
+
+	e := x.entryOf(item.Name)
+	if e.listings == 0 {
+		// prefer how the item is named over how it was searched
+		e.text = item.Name
+	}
+	e.listings++
+	x.categoryListings[item.CategoryID]++
+}
+
+// RemoveListing removes an item which is no longer on sale.
+func (x *Index) RemoveListing(id int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	delete(x.docs, id)
+	for _, token := range append(x.tokenizer.Tokens(doc.name), x.tokenizer.Tokens(doc.description)...) {
+		if ids, ok := x.postings[token]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(x.postings, token)
+			}
+		}
+	}
+
+	key := doc.name
+	if e, ok := x.entries[key]; ok && e.listings > 0 {
+		e.listings--
+		x.removeIfUnused(key, e)
+	}
+	if x.categoryListings[doc.item.CategoryID] > 0 {
+		x.categoryListings[doc.item.CategoryID]--
+	}
+}
+
+// RecordQuery counts a search which found items. It is saved to the DB on the next Flush.
+func (x *Index) RecordQuery(query string) {
+	key := Normalize(query)
+	if key == "" {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// the normalized form is shown, as it is what the DB keeps
+	x.entryOf(key).searches++
+	x.pending[key]++
+}
+
+// Flush saves the searches recorded since the last Flush.
+func (x *Index) Flush(ctx context.Context, repo db.SearchRepository) error {
+	x.mu.Lock()
+	pending := x.pending
+	x.pending = map[string]int64{}
+	x.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := repo.AddSearchQueries(ctx, pending, time.Now()); err != nil {
+		// keep them for the next Flush
+		x.mu.Lock()
+		for k, n := range pending {
+			x.pending[k] += n
+		}
+		x.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Search returns the items on sale whose normalized name or description contains the normalized query.
+// Items matching by name come first, each group ordered by the last update.
+func (x *Index) Search(query string) []domain.Item {
+	q := Normalize(query)
+	tokens := x.tokenizer.QueryTokens(q)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	// intersect the postings, starting from the shortest one
+	lists := make([]map[int64]struct{}, len(tokens))
+	for i, token := range tokens {
+		lists[i] = x.postings[token]
+		if len(lists[i]) == 0 {
+			return nil
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	var byName, byDescription []domain.Item
+candidates:
+	for id := range lists[0] {
+		for _, ids := range lists[1:] {
+			if _, ok := ids[id]; !ok {
+				continue candidates
+			}
+		}
+		// the tokens may be in a different order or in different words, so check the whole query
+		doc := x.docs[id]
+		switch {
+		case strings.Contains(doc.name, q):
+			byName = append(byName, doc.item)
+		case strings.Contains(doc.description, q):
+			byDescription = append(byDescription, doc.item)
+		}
+	}
+
+	for _, items := range [][]domain.Item{byName, byDescription} {
+		items := items
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].UpdatedAt != items[j].UpdatedAt {
+				return items[i].UpdatedAt > items[j].UpdatedAt
+			}
+			return items[i].ID > items[j].ID
+		})
+	}
+	return append(byName, byDescription...)
+}
+
+// Suggest returns up to limit completions of prefix out of the index and the categories, the most popular first.
+// Only the best limit completions are kept while the range of the prefix is scanned, so a short prefix costs no more memory than a long one.
+func (x *Index) Suggest(prefix string, categories []domain.Category, limit int) []Suggestion {
+	key := Normalize(prefix)
+	if key == "" || limit <= 0 {
+		return []Suggestion{}
+	}
+
+	top := &suggestionHeap{suggestions: []Suggestion{}, limit: limit}
+	x.mu.RLock()
+	for i := sort.SearchStrings(x.keys, key); i < len(x.keys) && strings.HasPrefix(x.keys[i], key); i++ {
+		e := x.entries[x.keys[i]]
+		kind := KindItem
+		if e.listings == 0 {
+			kind = KindQuery
+		}
+		top.offer(Suggestion{Text: e.text, Kind: kind, Score: e.listings + e.searches})
+	}
+	for _, cat := range categories {
+		if strings.HasPrefix(Normalize(cat.Name), key) {
+			top.offer(Suggestion{Text: cat.Name, Kind: KindCategory, Score: x.categoryListings[cat.ID]})
+		}
+	}
+	x.mu.RUnlock()
+
+	res := top.suggestions
+	sort.Slice(res, func(i, j int) bool { return ranksBefore(res[i], res[j]) })
+	return res
+}
+
+// ranksBefore orders the suggestions by score, then by text.
+func ranksBefore(a, b Suggestion) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Text < b.Text
+}
+
+// suggestionHeap keeps the best limit suggestions offered to it. The worst of them is at the root, to be replaced by a better one.
+type suggestionHeap struct {
+	suggestions []Suggestion
+	limit       int
+}
+
+func (h *suggestionHeap) offer(s Suggestion) {
+	if len(h.suggestions) < h.limit {
+		heap.Push(h, s)
+	} else if ranksBefore(s, h.suggestions[0]) {
+		h.suggestions[0] = s
+		heap.Fix(h, 0)
+	}
+}
+
+func (h *suggestionHeap) Len() int           { return len(h.suggestions) }
+func (h *suggestionHeap) Less(i, j int) bool { return ranksBefore(h.suggestions[j], h.suggestions[i]) }
+func (h *suggestionHeap) Swap(i, j int) {
+	h.suggestions[i], h.suggestions[j] = h.suggestions[j], h.suggestions[i]
+}
+func (h *suggestionHeap) Push(x any) { h.suggestions = append(h.suggestions, x.(Suggestion)) }
+func (h *suggestionHeap) Pop() any {
+	s := h.suggestions[len(h.suggestions)-1]
+	h.suggestions = h.suggestions[:len(h.suggestions)-1]
+	return s
+}
+
+// entryOf returns the entry of text, adding it when it is missing. x.mu must be locked.
+func (x *Index) entryOf(text string) *entry {
+	key := Normalize(text)
+	if e, ok := x.entries[key]; ok {
+		return e
+	}
+
+	e := &entry{text: text}
+	x.entries[key] = e
+	i := sort.SearchStrings(x.keys, key)
+	x.keys = append(x.keys, "")
+	copy(x.keys[i+1:], x.keys[i:])
+	x.keys[i] = key
+	return e
+}
+
+// removeIfUnused removes the entry once nothing refers to it. x.mu must be locked.
+func (x *Index) removeIfUnused(key string, e *entry) {
+	if e.listings > 0 || e.searches > 0 {
+		return
+	}
+	delete(x.entries, key)
+	i := sort.SearchStrings(x.keys, key)
+	x.keys = append(x.keys[:i], x.keys[i+1:]...)
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"ｽﾆｰｶｰ":          "スニーカー",
+		"すにーかー":          "スニーカー",
+		"ＮＩＫＥ  Air\tMax": "nike air max",
+		"  leading":      "leading",
+		"trailing  ":     "trailing",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func ids(items []domain.Item) []int64 {
+	res := []int64{}
+	for _, item := range items {
+		res = append(res, item.ID)
+	}
+	return res
+}
+
+func newTestIndex() *Index {
+	x := NewIndex(BigramTokenizer{})
+	for _, item := range []domain.Item{
+		{ID: 1, Name: "スニーカー", Description: "白", CategoryID: 1, UpdatedAt: "2023-06-01 00:00:01"},
+		{ID: 2, Name: "革靴", Description: "スニーカーではない", CategoryID: 1, UpdatedAt: "2023-06-01 00:00:03"},
+		{ID: 3, Name: "Nike スニーカー", Description: "", CategoryID: 2, UpdatedAt: "2023-06-01 00:00:02"},
+		{ID: 4, Name: "card deck", Description: "", CategoryID: 2, UpdatedAt: "2023-06-01 00:00:04", Image: []byte{1}},
+	} {
+		x.AddListing(item)
+	}
+	return x
+}
+
+func TestSearch(t *testing.T) {
+	x := newTestIndex()
+	for _, tt := range []struct {
+		query string
+		want  []int64
+	}{
+		// the names match first, then the descriptions, each the last updated first
+		{"スニーカー", []int64{3, 1, 2}},
+		// the variants of the text are normalized
+		{"ｽﾆｰｶｰ", []int64{3, 1, 2}},
+		{"すにーかー", []int64{3, 1, 2}},
+		{"NIKE", []int64{3}},
+		{"白", []int64{1}},
+		// "card deck" has the bigrams of "deck card", but doesn't contain it
+		{"deck card", []int64{}},
+		{"ブーツ", []int64{}},
+		{"  ", []int64{}},
+	} {
+		if got := ids(x.Search(tt.query)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, item := range x.Search("card") {
+		if item.Image != nil {
+			t.Error("the index keeps the image")
+		}
+	}
+
+	x.RemoveListing(3)
+	if got := ids(x.Search("スニーカー")); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Search after RemoveListing = %v, want [1 2]", got)
+	}
+	// adding an item again doesn't index it twice
+	x.AddListing(domain.Item{ID: 1, Name: "スニーカー"})
+	if got := ids(x.Search("スニーカー")); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Search after adding an item twice = %v, want [1 2]", got)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	x := newTestIndex()
+	x.RecordQuery("すにーかー 白")
+	x.RecordQuery("スニーカー 白")
+	categories := []domain.Category{{ID: 1, Name: "シューズ"}, {ID: 2, Name: "スニーカー類"}}
+
+	want := []Suggestion{
+		{Text: "スニーカー 白", Kind: KindQuery, Score: 2},
+		{Text: "スニーカー類", Kind: KindCategory, Score: 2},
+		{Text: "スニーカー", Kind: KindItem, Score: 1},
+	}
+	if got := x.Suggest("ｽﾆ", categories, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("Suggest = %+v, want %+v", got, want)
+	}
+	if got := x.Suggest("ｽﾆ", categories, 1); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("Suggest with limit 1 = %+v, want %+v", got, want[:1])
+	}
+
+	if got := x.Suggest("ｽﾆｰｶｰｽﾞ", categories, 10); got == nil || len(got) != 0 {
+		t.Errorf("Suggest without completions = %#v, want an empty slice", got)
+	}
+
+	// an item name which is no longer on sale is not suggested
+	x.RemoveListing(1)
+	for _, s := range x.Suggest("スニーカー", nil, 10) {
+		if s.Text == "スニーカー" {
+			t.Errorf("suggested %+v after the item was removed", s)
+		}
+	}
+}
+
+func TestSuggestTop(t *testing.T) {
+	x := NewIndex(BigramTokenizer{})
+	// query i is recorded i%7 times, so that the scores tie and come in no particular order
+	for i := 0; i < 100; i++ {
+		for n := 0; n < i%7; n++ {
+			x.RecordQuery(fmt.Sprintf("q%02d", i))
+		}
+	}
+
+	all := x.Suggest("q", nil, 100)
+	if len(all) != 85 {
+		t.Fatalf("%d suggestions, want the 85 queries recorded at least once", len(all))
+	}
+	for _, limit := range []int{1, 5, 14, 15, 85} {
+		if got := x.Suggest("q", nil, limit); !reflect.DeepEqual(got, all[:limit]) {
+			t.Errorf("Suggest with limit %d = %v, want %v", limit, got, all[:limit])
+		}
+	}
+	if all[0] != (Suggestion{Text: "q06", Kind: KindQuery, Score: 6}) || all[84] != (Suggestion{Text: "q99", Kind: KindQuery, Score: 1}) {
+		t.Errorf("best %+v and worst %+v suggestions", all[0], all[84])
+	}
+}
@@ -0,0 +1,131 @@
+package search
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// ItemRepository keeps the Index up to date with the items which are put on or taken off sale through it.
+type ItemRepository struct {
+	db.ItemRepository
+
+	index *Index
+	// mu serializes status updates, so that the status read before an update is still the one it replaces
+	mu sync.Mutex
+}
+
+func NewItemRepository(repo db.ItemRepository, index *Index) *ItemRepository {
+	return &ItemRepository{ItemRepository: repo, index: index}
+}
+
+func (r *ItemRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
+	item, err := r.ItemRepository.AddItem(ctx, item)
+	if err != nil {
+		return item, err
+	}
+	if item.Status == domain.ItemStatusOnSale {
+		r.index.AddListing(item)
+	}
+	return item, nil
+}
+
+func (r *ItemRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, err := r.ItemRepository.GetItem(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.ItemRepository.UpdateItemStatus(ctx, id, status); err != nil {
+		return err
+	}
+
+	switch {
+	case item.Status != domain.ItemStatusOnSale && status == domain.ItemStatusOnSale:
+		r.index.AddListing(item)
+	case item.Status == domain.ItemStatusOnSale && status != domain.ItemStatusOnSale:
+		r.index.RemoveListing(item.ID)
+	}
+	return nil
+}
+
+func (r *ItemRepository) Moderate(ctx context.Context, id int64, status domain.ItemStatus, log domain.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, err := r.ItemRepository.GetItem(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.ItemRepository.Moderate(ctx, id, status, log); err != nil {
+		return err
+	}
+	if item.Status == domain.ItemStatusOnSale {
+		r.index.RemoveListing(id)
+	}
+	return nil
+}
+
+func (r *ItemRepository) Restore(ctx context.Context, id int64, log domain.AuditLog) (domain.ItemStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, err := r.ItemRepository.GetItem(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	status, err := r.ItemRepository.Restore(ctx, id, log)
+	if err != nil {
+		return 0, err
+	}
+	if status == domain.ItemStatusOnSale {
+		item.Status = status
+		r.index.AddListing(item)
+	}
+	return status, nil
+}
+
+func (r *ItemRepository) Report(ctx context.Context, report domain.Report, limits domain.ReportLimits) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hidden, err := r.ItemRepository.Report(ctx, report, limits)
+	if err != nil {
+		return false, err
+	}
+	if hidden {
+		r.index.RemoveListing(report.ItemID)
+	}
+	return hidden, nil
+}
+
+func (r *ItemRepository) ListItem(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, err := r.ItemRepository.GetItem(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.ItemRepository.ListItem(ctx, id); err != nil {
+		return err
+	}
+	item.Status = domain.ItemStatusOnSale
+	r.index.AddListing(item)
+	return nil
+}
+
+func (r *ItemRepository) Purchase(ctx context.Context, id int64, buyerID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.ItemRepository.Purchase(ctx, id, buyerID); err != nil {
+		return err
+	}
+	r.index.RemoveListing(id)
+	return nil
+}
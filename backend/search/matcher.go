@@ -0,0 +1,92 @@
+package search
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/notification"
+)
+
+// Matcher notifies the users whose saved searches match an item put on sale.
+type Matcher struct {
+	items    db.ItemRepository
+	searches db.SavedSearchRepository
+	notifier *notification.Service
+}
+
+func NewMatcher(items db.ItemRepository, searches db.SavedSearchRepository, notifier *notification.Service) *Matcher {
+	return &Matcher{items: items, searches: searches, notifier: notifier}
+}
+
+// Match notifies the saved searches of other users which match the item, one notification per user.
+// It is run for ItemListed in the background, so that listing doesn't wait for the saved searches of every user.
+func (m *Matcher) Match(ctx context.Context, itemID int64) error {
+	item, err := m.items.GetItem(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	// it may be sold or taken down already
+	if item.Status != domain.ItemStatusOnSale {
+		return nil
+	}
+
+	searches, err := m.searches.GetSavedSearches(ctx)
+	if err != nil {
+		return err
+	}
+	cats, err := m.items.GetCategories(ctx)
+	if err != nil {
+		return err
+	}
+	parents := make(map[int64]int64, len(cats))
+	for _, cat := range cats {
+		parents[cat.ID] = cat.ParentID
+	}
+	// the category of the item and its ancestors, which a saved search may name
+	ancestors := map[int64]bool{}
+	for id := item.CategoryID; id != 0 && !ancestors[id]; id = parents[id] {
+		ancestors[id] = true
+	}
+
+	name, description := Normalize(item.Name), Normalize(item.Description)
+	var notifications []domain.Notification
+	notified := map[int64]bool{}
+	for _, s := range searches {
+		if s.UserID == item.UserID || notified[s.UserID] {
+			continue
+		}
+		if !matches(s, item, name, description, ancestors) {
+			continue
+		}
+		notified[s.UserID] = true
+		notifications = append(notifications, notification.SavedSearchMatched(s, item))
+	}
+	return m.notifier.Publish(ctx, notifications...)
+}
+
+// matches reports whether the item matches the saved search.
+// name and description are normalized, and ancestors has the category of the item and its ancestors.
+func matches(s domain.SavedSearch, item domain.Item, name, description string, ancestors map[int64]bool) bool {
+	if s.MinPrice != nil && item.Price < *s.MinPrice {
+		return false
+	}
+	if s.MaxPrice != nil && item.Price > *s.MaxPrice {
+		return false
+	}
+	if len(s.CategoryIDs) > 0 {
+		found := false
+		for _, id := range s.CategoryIDs {
+			if ancestors[id] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	q := Normalize(s.Query)
+	return strings.Contains(name, q) || strings.Contains(description, q)
+}
@@ -0,0 +1,40 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize folds the variants of a text which users expect to match each other:
+//
+//   - full-width and half-width forms by NFKC, e.g. "ｽﾆｰｶｰ" and "Ａ" become "スニーカー" and "A"
+//   - upper and lower case
+//   - hiragana and katakana, by turning hiragana into katakana
+//   - runs of white space, which become a single space
+func Normalize(s string) string {
+	s = norm.NFKC.String(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		case 'ぁ' <= r && r <= 'ゖ', 'ゝ' <= r && r <= 'ゞ':
+			// the katakana block has the same layout, 0x60 after the hiragana one
+			r += 'ァ' - 'ぁ'
+		default:
+			r = unicode.ToLower(r)
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package search
+
+import "strings"
+
+// Tokenizer splits normalized texts into the tokens of the inverted index.
+// Tokens only select candidates, which are then checked to contain the query, so a tokenizer may over-match but must not miss.
+type Tokenizer interface {
+	// Tokens returns the tokens a document is indexed by.
+	Tokens(text string) []string
+	// QueryTokens returns tokens which every document containing the query has.
+	QueryTokens(query string) []string
+}
+
+// BigramTokenizer indexes every character and every pair of adjacent characters within a word.
+// It needs no dictionary, so it works for Japanese, which isn't separated by spaces, as well as for other languages.
+type BigramTokenizer struct{}
+
+func (BigramTokenizer) Tokens(text string) []string {
+	var tokens []string
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for i := range runes {
+			tokens = append(tokens, string(runes[i]))
+			if i+1 < len(runes) {
+				tokens = append(tokens, string(runes[i:i+2]))
+			}
+		}
+	}
+	return tokens
+}
+
+func (BigramTokenizer) QueryTokens(query string) []string {
+	var tokens []string
+	for _, word := range strings.Fields(query) {
+		runes := []rune(word)
+		if len(runes) == 1 {
+			tokens = append(tokens, word)
+			continue
+		}
+		for i := 0; i+1 < len(runes); i++ {
+			tokens = append(tokens, string(runes[i:i+2]))
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSuggestPrefix(t *testing.T) {
+	s := newTestServer(t)
+	_, seller := s.register("seller")
+	s.sell(seller, "jacket", 500)
+
+	for _, tt := range []struct {
+		q    string
+		want int
+	}{
+		{"", http.StatusBadRequest},
+		{"j", http.StatusBadRequest},
+		// the length is counted after normalization
+		{"  j  ", http.StatusBadRequest},
+		{"ja", http.StatusOK},
+		{"ＪＡ", http.StatusOK},
+	} {
+		var suggestions []struct {
+			Text string `json:"text"`
+		}
+		status := s.do(http.MethodGet, "/search/suggest?q="+url.QueryEscape(tt.q), "", nil, &suggestions)
+		if status != tt.want {
+			t.Errorf("suggest %q: status %d, want %d", tt.q, status, tt.want)
+		}
+		if status == http.StatusOK && (len(suggestions) != 1 || suggestions[0].Text != "jacket") {
+			t.Errorf("suggest %q = %+v, want the jacket", tt.q, suggestions)
+		}
+	}
+}
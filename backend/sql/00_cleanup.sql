@@ -1,4 +1,18 @@
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS search_queries;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS item_moderations;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS saved_searches;
 DROP TABLE items;
 DROP TABLE users;
 DROP TABLE category;
-DROP TABLE status;
\ No newline at end of file
+DROP TABLE status;
+DROP TABLE IF EXISTS schema_migrations;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- Adds the role, the suspension, the email and the profile of a user.
+-- The avatar is served with the image type it was detected as on upload.
+-- ALTER TABLE can't add a UNIQUE column or one defaulting to the current time, so the table is rebuilt and its rows copied over.
+
+CREATE TABLE users_new
+(
+    id          integer primary key autoincrement,
+    name        varchar(50),
+    password    binary(60),
+    email       varchar(254) UNIQUE,
+    balance     integer default 0,
+    role        varchar(10) NOT NULL DEFAULT 'user',
+    suspended   integer     NOT NULL DEFAULT 0,
+    bio         text        NOT NULL DEFAULT '',
+    avatar      blob,
+    avatar_type varchar(20),
+    created_at  text        NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+INSERT INTO users_new (id, name, password, balance)
+SELECT id, name, password, balance
+FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
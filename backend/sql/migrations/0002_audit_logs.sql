@@ -0,0 +1,21 @@
+-- Actions taken by admins, e.g. a balance adjustment or a takedown of an item.
+CREATE TABLE audit_logs
+(
+    id          integer primary key autoincrement,
+    admin_id    integer NOT NULL,
+    action      varchar(50) NOT NULL,
+    target_type varchar(20) NOT NULL,
+    target_id   integer NOT NULL,
+    amount      integer NOT NULL DEFAULT 0,
+    reason      text NOT NULL,
+    created_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+-- The status of an item before it was hidden by reports or taken down by an admin, which it gets back when it is restored.
+-- There is a row while the item is under moderation.
+CREATE TABLE item_moderations
+(
+    item_id         integer primary key REFERENCES items (id),
+    previous_status integer NOT NULL REFERENCES status (id),
+    created_at      text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
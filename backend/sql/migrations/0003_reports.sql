@@ -0,0 +1,13 @@
+-- Reports of items by users. A user reports an item at most once.
+-- Reports are resolved when an admin restores the item, so that only the reports since the last review count towards hiding it again.
+CREATE TABLE reports
+(
+    id          integer primary key autoincrement,
+    item_id     integer NOT NULL,
+    reporter_id integer NOT NULL,
+    reason      varchar(20) NOT NULL,
+    comment     text NOT NULL DEFAULT '',
+    created_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    resolved_at text,
+    UNIQUE (item_id, reporter_id)
+);
@@ -0,0 +1,10 @@
+-- Tokens of the password reset. Only the SHA-256 of a token is stored.
+CREATE TABLE password_resets
+(
+    id         integer primary key autoincrement,
+    user_id    integer NOT NULL,
+    token_hash char(64) NOT NULL UNIQUE,
+    expires_at text NOT NULL,
+    used_at    text,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
@@ -0,0 +1,72 @@
+-- Adds foreign keys and the indexes of the queries in the repositories.
+-- SQLite can't add a constraint to an existing table, so the tables are rebuilt and their rows copied over.
+
+INSERT OR IGNORE INTO status (id, name)
+VALUES (1, 'initial'),
+       (2, 'on_sale'),
+       (3, 'sold_out'),
+       (4, 'moderated'),
+       (5, 'hidden');
+
+CREATE TABLE items_new
+(
+    id          integer primary key autoincrement,
+    name        varchar(50),
+    price       integer,
+    description text,
+    category_id integer REFERENCES category (id),
+    seller_id   integer REFERENCES users (id),
+    image       blob,
+    status      integer REFERENCES status (id),
+    created_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+INSERT INTO items_new (id, name, price, description, category_id, seller_id, image, status, created_at, updated_at)
+SELECT id, name, price, description, category_id, seller_id, image, status, created_at, updated_at
+FROM items;
+DROP TABLE items;
+ALTER TABLE items_new RENAME TO items;
+
+CREATE TABLE reports_new
+(
+    id          integer primary key autoincrement,
+    item_id     integer NOT NULL REFERENCES items (id),
+    reporter_id integer NOT NULL REFERENCES users (id),
+    reason      varchar(20) NOT NULL,
+    comment     text NOT NULL DEFAULT '',
+    created_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    resolved_at text,
+    UNIQUE (item_id, reporter_id)
+);
+INSERT INTO reports_new (id, item_id, reporter_id, reason, comment, created_at, resolved_at)
+SELECT id, item_id, reporter_id, reason, comment, created_at, resolved_at
+FROM reports;
+DROP TABLE reports;
+ALTER TABLE reports_new RENAME TO reports;
+
+CREATE TABLE password_resets_new
+(
+    id         integer primary key autoincrement,
+    user_id    integer NOT NULL REFERENCES users (id),
+    token_hash char(64) NOT NULL UNIQUE,
+    expires_at text NOT NULL,
+    used_at    text,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+INSERT INTO password_resets_new (id, user_id, token_hash, expires_at, used_at, created_at)
+SELECT id, user_id, token_hash, expires_at, used_at, created_at
+FROM password_resets;
+DROP TABLE password_resets;
+ALTER TABLE password_resets_new RENAME TO password_resets;
+
+-- listings filter by status and are sorted by updated_at
+CREATE INDEX items_status_updated_at ON items (status, updated_at);
+-- items of a user and the counts of the profile
+CREATE INDEX items_seller_id_status ON items (seller_id, status);
+CREATE INDEX items_category_id ON items (category_id);
+
+CREATE INDEX users_suspended ON users (suspended);
+
+-- reports.item_id is covered by UNIQUE (item_id, reporter_id)
+CREATE INDEX reports_reporter_id_created_at ON reports (reporter_id, created_at);
+CREATE INDEX password_resets_user_id ON password_resets (user_id);
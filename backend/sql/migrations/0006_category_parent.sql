@@ -0,0 +1,4 @@
+-- Categories form a tree. parent_id is NULL for a root category.
+ALTER TABLE category ADD COLUMN parent_id integer REFERENCES category (id);
+
+CREATE INDEX category_parent_id ON category (parent_id);
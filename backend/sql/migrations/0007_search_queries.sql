@@ -0,0 +1,7 @@
+-- Queries searched with GET /search which found items. They rank the suggestions of GET /search/suggest.
+CREATE TABLE search_queries
+(
+    query            text primary key,
+    count            integer NOT NULL DEFAULT 0,
+    last_searched_at text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
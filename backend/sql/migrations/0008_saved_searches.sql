@@ -0,0 +1,25 @@
+-- Searches saved by users. Items put on sale which match them are announced in the notifications of the user.
+-- category_ids is a JSON array of category IDs, which include their descendants.
+CREATE TABLE saved_searches
+(
+    id           integer primary key autoincrement,
+    user_id      integer NOT NULL REFERENCES users (id),
+    query        text    NOT NULL DEFAULT '',
+    category_ids text    NOT NULL DEFAULT '[]',
+    min_price    integer,
+    max_price    integer,
+    created_at   text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX saved_searches_user_id ON saved_searches (user_id);
+
+-- The inbox of each user. item_id is the item the notification is about, if any.
+CREATE TABLE notifications
+(
+    id         integer primary key autoincrement,
+    user_id    integer     NOT NULL REFERENCES users (id),
+    kind       varchar(30) NOT NULL,
+    item_id    integer REFERENCES items (id),
+    message    text        NOT NULL,
+    created_at text        NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX notifications_user_id ON notifications (user_id, id);
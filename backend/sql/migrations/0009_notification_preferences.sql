@@ -0,0 +1,15 @@
+-- read_at is NULL until the user marks the notification as read.
+ALTER TABLE notifications ADD COLUMN read_at text;
+
+-- the unread count of a user
+CREATE INDEX notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+-- How each kind of notification is delivered to a user. A missing row means the defaults of the kind.
+CREATE TABLE notification_preferences
+(
+    user_id integer     NOT NULL REFERENCES users (id),
+    kind    varchar(30) NOT NULL,
+    inbox   integer     NOT NULL,
+    email   integer     NOT NULL,
+    primary key (user_id, kind)
+);
@@ -0,0 +1,20 @@
+-- Domain events written in the same transaction as the change they describe, and dispatched to the subscribers afterwards.
+-- done is a JSON array of the subscribers which handled the event, so that a retry skips them.
+-- An event is dispatched once dispatched_at is set, or given up once failed_at is set.
+CREATE TABLE outbox
+(
+    id              integer primary key autoincrement,
+    type            varchar(30) NOT NULL,
+    payload         text        NOT NULL,
+    attempts        integer     NOT NULL DEFAULT 0,
+    done            text        NOT NULL DEFAULT '[]',
+    last_error      text,
+    next_attempt_at text        NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    dispatched_at   text,
+    failed_at       text,
+    created_at      text        NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+-- the events waiting to be dispatched
+CREATE INDEX outbox_pending ON outbox (next_attempt_at) WHERE dispatched_at IS NULL AND failed_at IS NULL;
+-- the dispatched events which are cleaned up
+CREATE INDEX outbox_dispatched_at ON outbox (dispatched_at) WHERE dispatched_at IS NOT NULL;
@@ -0,0 +1,31 @@
+-- Endpoints which are sent the domain events of the types in event_types, a JSON array, signed with secret.
+CREATE TABLE webhooks
+(
+    id          integer primary key autoincrement,
+    user_id     integer NOT NULL REFERENCES users (id),
+    url         text    NOT NULL,
+    event_types text    NOT NULL,
+    secret      text    NOT NULL,
+    created_at  text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX webhooks_user_id ON webhooks (user_id);
+
+-- An event to be sent to a webhook, and the log of the attempts.
+-- status is pending until the endpoint accepted it (succeeded) or the attempts ran out (dead).
+CREATE TABLE webhook_deliveries
+(
+    id              integer primary key autoincrement,
+    webhook_id      integer     NOT NULL REFERENCES webhooks (id),
+    event_type      varchar(30) NOT NULL,
+    payload         text        NOT NULL,
+    status          varchar(10) NOT NULL DEFAULT 'pending',
+    attempts        integer     NOT NULL DEFAULT 0,
+    response_status integer,
+    last_error      text,
+    next_attempt_at text        NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    delivered_at    text,
+    created_at      text        NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+-- the deliveries waiting to be sent
+CREATE INDEX webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
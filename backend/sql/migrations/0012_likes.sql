@@ -0,0 +1,11 @@
+-- Items bookmarked by users. A user likes an item at most once.
+CREATE TABLE likes
+(
+    id         integer primary key autoincrement,
+    user_id    integer NOT NULL REFERENCES users (id),
+    item_id    integer NOT NULL REFERENCES items (id),
+    created_at text    NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    UNIQUE (user_id, item_id)
+);
+-- the like count and the users to notify when an item is sold
+CREATE INDEX likes_item_id ON likes (item_id);
@@ -0,0 +1,11 @@
+-- Public questions and answers on an item, written by any user while it is on sale.
+CREATE TABLE comments
+(
+    id         integer primary key autoincrement,
+    item_id    integer NOT NULL REFERENCES items (id),
+    user_id    integer NOT NULL REFERENCES users (id),
+    body       text    NOT NULL,
+    created_at text    NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated_at text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+CREATE INDEX comments_item_id ON comments (item_id, id);
@@ -0,0 +1,56 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the number of writes between removals of stale entries.
+const sweepInterval = 1024
+
+// MemoryStore is a Store kept in the process memory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	m      map[string]Attempts
+	ttl    time.Duration
+	writes int
+}
+
+// NewMemoryStore returns a store which drops entries that have not failed nor been locked for ttl.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{m: make(map[string]Attempts), ttl: ttl}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[key], nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, a Attempts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.m[key] = a
+	s.writes++
+	if s.writes%sweepInterval == 0 {
+		s.sweep(time.Now())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for k, a := range s.m {
+		if now.After(a.LockedUntil) && now.Sub(a.LastFailure) > s.ttl {
+			delete(s.m, k)
+		}
+	}
+}
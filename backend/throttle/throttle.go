@@ -0,0 +1,127 @@
+// Package throttle slows down repeated failures such as password guessing.
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempts is the failure history of a key.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store keeps Attempts by key. MemoryStore is enough for a single process;
+// implement it on top of the DB to share the state between processes.
+type Store interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	Put(ctx context.Context, key string, a Attempts) error
+	Delete(ctx context.Context, key string) error
+}
+
+type Config struct {
+	// FreeAttempts is the number of failures allowed without any delay.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure beyond FreeAttempts. It doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold is the number of failures that locks the key for LockoutDuration.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetAfter forgets the failures when there was no failure for this long.
+	ResetAfter time.Duration
+}
+
+// Guard applies exponential backoff and temporary lockout to keys such as "user:1" or "ip:192.0.2.1".
+type Guard struct {
+	// mu serializes the read-modify-write in Reserve and Release
+	mu     sync.Mutex
+	store  Store
+	prefix string
+	config Config
+	now    func() time.Time
+}
+
+func NewGuard(store Store, prefix string, config Config) *Guard {
+	return &Guard{store: store, prefix: prefix, config: config, now: time.Now}
+}
+
+// Reserve counts an attempt for key as failed before it is made, unless the key has to wait.
+// It returns how long the caller has to wait before the next attempt is allowed, zero when the attempt was reserved.
+// Checking and counting at once keeps concurrent attempts from all passing the check before any of them failed.
+// A reserved attempt which succeeds is given back with Release or Succeed.
+func (g *Guard) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, err := g.store.Get(ctx, g.prefix+key)
+	if err != nil {
+		return 0, err
+	}
+	now := g.now()
+	if g.expired(a, now) {
+		a = Attempts{}
+	}
+
+	next := a.LockedUntil
+	if t := a.LastFailure.Add(g.delay(a.Failures)); t.After(next) {
+		next = t
+	}
+	if next.After(now) {
+		return next.Sub(now), nil
+	}
+
+	a.Failures++
+	a.LastFailure = now
+	if g.config.LockoutThreshold > 0 && a.Failures >= g.config.LockoutThreshold {
+		a.LockedUntil = now.Add(g.config.LockoutDuration)
+		// start over once the lockout ends
+		a.Failures = 0
+	}
+	return 0, g.store.Put(ctx, g.prefix+key, a)
+}
+
+// Release gives back an attempt reserved for key which succeeded, keeping the other failures.
+func (g *Guard) Release(ctx context.Context, key string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, err := g.store.Get(ctx, g.prefix+key)
+	if err != nil {
+		return err
+	}
+	if a.Failures == 0 {
+		return nil
+	}
+	a.Failures--
+	return g.store.Put(ctx, g.prefix+key, a)
+}
+
+// Succeed forgets the failures of key.
+func (g *Guard) Succeed(ctx context.Context, key string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.store.Delete(ctx, g.prefix+key)
+}
+
+func (g *Guard) delay(failures int) time.Duration {
+	n := failures - g.config.FreeAttempts
+	if n <= 0 {
+		return 0
+	}
+	d := g.config.BaseDelay
+	for i := 1; i < n && d < g.config.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > g.config.MaxDelay {
+		d = g.config.MaxDelay
+	}
+	return d
+}
+
+func (g *Guard) expired(a Attempts, now time.Time) bool {
+	return now.After(a.LockedUntil) && now.Sub(a.LastFailure) > g.config.ResetAfter
+}
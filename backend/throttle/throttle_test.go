@@ -0,0 +1,168 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	ResetAfter:       time.Hour,
+}
+
+// newTestGuard returns a guard whose clock only moves with the returned func.
+func newTestGuard() (*Guard, func(time.Duration)) {
+	g := NewGuard(NewMemoryStore(time.Hour), "test:", testConfig)
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	return g, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestReserveConcurrent(t *testing.T) {
+	ctx := context.Background()
+	g, _ := newTestGuard()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := g.Reserve(ctx, "1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the free attempts and the one which starts the backoff, however many are in flight
+	if want := testConfig.FreeAttempts + 1; allowed != want {
+		t.Errorf("%d of 30 parallel attempts were allowed, want %d", allowed, want)
+	}
+}
+
+func TestReserveBackoff(t *testing.T) {
+	ctx := context.Background()
+	g, advance := newTestGuard()
+
+	for i := 0; i <= testConfig.FreeAttempts; i++ {
+		if wait, err := g.Reserve(ctx, "1"); err != nil || wait != 0 {
+			t.Fatalf("attempt %d: wait = %s, err = %v", i+1, wait, err)
+		}
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		wait, err := g.Reserve(ctx, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != want {
+			t.Fatalf("wait = %s, want %s", wait, want)
+		}
+		// waiting doesn't count as an attempt
+		if again, _ := g.Reserve(ctx, "1"); again != want {
+			t.Fatalf("wait after a rejected attempt = %s, want %s", again, want)
+		}
+		advance(want)
+		if wait, err := g.Reserve(ctx, "1"); err != nil || wait != 0 {
+			t.Fatalf("attempt after the backoff: wait = %s, err = %v", wait, err)
+		}
+	}
+
+	// another key is not affected
+	if wait, _ := g.Reserve(ctx, "2"); wait != 0 {
+		t.Errorf("wait of another key = %s", wait)
+	}
+}
+
+func TestReserveLockout(t *testing.T) {
+	ctx := context.Background()
+	g, advance := newTestGuard()
+
+	for i := 0; i < testConfig.LockoutThreshold; i++ {
+		wait, err := g.Reserve(ctx, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		advance(wait)
+		if wait > 0 {
+			if _, err := g.Reserve(ctx, "1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	wait, err := g.Reserve(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != testConfig.LockoutDuration {
+		t.Errorf("wait after %d failures = %s, want the lockout of %s", testConfig.LockoutThreshold, wait, testConfig.LockoutDuration)
+	}
+
+	advance(testConfig.LockoutDuration)
+	if wait, _ := g.Reserve(ctx, "1"); wait != 0 {
+		t.Errorf("wait after the lockout = %s", wait)
+	}
+}
+
+func TestReleaseAndSucceed(t *testing.T) {
+	ctx := context.Background()
+	g, _ := newTestGuard()
+
+	// attempts which succeed never back off
+	for i := 0; i < 2*testConfig.FreeAttempts; i++ {
+		if wait, _ := g.Reserve(ctx, "1"); wait != 0 {
+			t.Fatalf("attempt %d: wait = %s", i+1, wait)
+		}
+		if err := g.Release(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i <= testConfig.FreeAttempts; i++ {
+		g.Reserve(ctx, "1")
+	}
+	if wait, _ := g.Reserve(ctx, "1"); wait == 0 {
+		t.Fatal("no backoff after the free attempts")
+	}
+	if err := g.Succeed(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := g.Reserve(ctx, "1"); wait != 0 {
+		t.Errorf("wait after Succeed = %s", wait)
+	}
+}
+
+func TestReserveResetAfter(t *testing.T) {
+	ctx := context.Background()
+	g, advance := newTestGuard()
+
+	for i := 0; i <= testConfig.FreeAttempts; i++ {
+		g.Reserve(ctx, "1")
+	}
+	advance(testConfig.ResetAfter + time.Second)
+
+	// the failures are forgotten, so the free attempts are available again
+	for i := 0; i <= testConfig.FreeAttempts; i++ {
+		if wait, _ := g.Reserve(ctx, "1"); wait != 0 {
+			t.Fatalf("attempt %d after the reset: wait = %s", i+1, wait)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateAvatar(t *testing.T) {
+	s := newTestServer(t)
+	id, token := s.register("alice")
+	avatarURL := fmt.Sprintf("%s/users/%d/avatar", s.url, id)
+
+	for name, file := range map[string][]byte{
+		"html": []byte("<html><script>alert(document.cookie)</script></html>"),
+		"svg":  []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`),
+		"text": []byte("hello"),
+	} {
+		req := s.multipartRequest(http.MethodPut, "/users/me", map[string]string{"name": "alice"}, "avatar", file)
+		if status := s.send(req, token, nil); status != http.StatusBadRequest {
+			t.Errorf("%s avatar: status %d, want 400", name, status)
+		}
+	}
+	if resp, err := http.Get(avatarURL); err != nil {
+		t.Fatal(err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("avatar after refused uploads: status %d, want 404", resp.StatusCode)
+	}
+
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	req := s.multipartRequest(http.MethodPut, "/users/me", map[string]string{"name": "alice"}, "avatar", gif)
+	// the type claimed by the client doesn't matter
+	if status := s.send(req, token, nil); status != http.StatusOK {
+		t.Fatalf("GIF avatar: status %d", status)
+	}
+
+	resp, err := http.Get(avatarURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != string(gif) {
+		t.Fatalf("avatar: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if got := resp.Header.Get("Content-Type"); got != "image/gif" {
+		t.Errorf("Content-Type = %q, want image/gif", got)
+	}
+	if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+
+	// updating the profile without an avatar keeps it and its type
+	req = s.multipartRequest(http.MethodPut, "/users/me", map[string]string{"name": "alice", "bio": "hi"}, "", nil)
+	if status := s.send(req, token, nil); status != http.StatusOK {
+		t.Fatalf("profile without avatar: status %d", status)
+	}
+	resp, err = http.Get(avatarURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || got != "image/gif" {
+		t.Errorf("avatar after a profile update: status %d, Content-Type %q", resp.StatusCode, got)
+	}
+}
@@ -0,0 +1,281 @@
+// Package webhook sends the domain events to the endpoints of partners as signed JSON requests.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+// Headers of the requests. The signature is "sha256=" and the hex HMAC-SHA256 of the body with the secret of the webhook.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	batchSize = 100
+	// pollInterval is how often the due retries are looked for.
+	pollInterval = time.Second
+	// concurrency is the number of requests in flight, so that a slow endpoint doesn't hold up the others.
+	concurrency = 4
+	// maxResponseSize is how much of a response is read, which is discarded.
+	maxResponseSize = 64 << 10
+)
+
+// Payload is the body of a request.
+type Payload struct {
+	Type domain.EventType `json:"type"`
+	Data domain.Event     `json:"data"`
+}
+
+// Signature is the value of HeaderSignature for the body.
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher stores a delivery for each webhook an event is subscribed by, and sends the deliveries in the background.
+// A delivery succeeds when the endpoint responds with 2xx. Otherwise it is retried with backoff
+// until the attempts run out and it is moved to the dead letter state.
+type Dispatcher struct {
+	repo   db.WebhookRepository
+	client *http.Client
+	cfg    config.Webhook
+	// added is signaled when deliveries were added, so that they are sent without waiting for the poll
+	added chan struct{}
+}
+
+// NewDispatcher sends the requests with client, or when it is nil, a client which doesn't follow redirects
+// and refuses to connect to private addresses other than cfg.AllowedPrivateNetworks.
+func NewDispatcher(repo db.WebhookRepository, client *http.Client, cfg config.Webhook) *Dispatcher {
+	if client == nil {
+		dialer := &net.Dialer{
+			Timeout: cfg.Timeout,
+			Control: dialControl(cfg.AllowedPrivateNetworks),
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// a proxy would connect to the address instead of the dialer
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		client = &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return &Dispatcher{repo: repo, client: client, cfg: cfg, added: make(chan struct{}, 1)}
+}
+
+// dialControl refuses connections to loopback, private and link-local addresses outside of the allowed CIDRs.
+// It checks the address which is connected to after the name was resolved, so a public name of a private address
+// or one which changes its address after the webhook was added is refused as well.
+func dialControl(allowed []string) func(network, address string, c syscall.RawConn) error {
+	var allowedNets []*net.IPNet
+	for _, cidr := range allowed {
+		// validated by config
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		allowedNets = append(allowedNets, ipNet)
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("invalid address %s", address)
+		}
+		if !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()) {
+			return nil
+		}
+		for _, ipNet := range allowedNets {
+			if ipNet.Contains(ip) {
+				return nil
+			}
+		}
+		return fmt.Errorf("connecting to the private address %s is not allowed", ip)
+	}
+}
+
+// Enqueue adds a delivery of the event to each webhook subscribed to its type. It is the handler of the events on the bus.
+func (d *Dispatcher) Enqueue(ctx context.Context, e domain.Event) error {
+	webhooks, err := d.repo.GetWebhooksByEventType(ctx, e.EventType())
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(Payload{Type: e.EventType(), Data: e})
+	if err != nil {
+		return err
+	}
+	deliveries := make([]domain.WebhookDelivery, len(webhooks))
+	for i, w := range webhooks {
+		deliveries[i] = domain.WebhookDelivery{WebhookID: w.ID, EventType: e.EventType(), Payload: payload}
+	}
+	if err := d.repo.AddDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	d.signal()
+	return nil
+}
+
+// Redeliver sends a delivery of the webhook again with fresh attempts, e.g. one in the dead letter state.
+func (d *Dispatcher) Redeliver(ctx context.Context, id, webhookID int64) error {
+	if err := d.repo.RedeliverDelivery(ctx, id, webhookID, time.Now()); err != nil {
+		return err
+	}
+	d.signal()
+	return nil
+}
+
+func (d *Dispatcher) signal() {
+	select {
+	case d.added <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the deliveries until ctx is done. The pending ones are sent after the next start.
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		d.sendPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.added:
+		case <-poll.C:
+		}
+	}
+}
+
+// sendPending sends the deliveries which are due, until there are none or ctx is done.
+func (d *Dispatcher) sendPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		// the requests which were started are not canceled, so that their results are recorded
+		pending, err := d.repo.GetPendingDeliveries(context.Background(), time.Now(), batchSize)
+		if err != nil {
+			log.Printf("failed to get pending webhook deliveries: %s", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for _, delivery := range pending {
+			if ctx.Err() != nil {
+				break
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(delivery domain.WebhookDelivery) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if err := d.deliver(context.Background(), delivery); err != nil {
+					log.Printf("failed to record webhook delivery %d: %s", delivery.ID, err)
+				}
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(pending) < batchSize {
+			return
+		}
+	}
+}
+
+// deliver sends the delivery once and records the result.
+func (d *Dispatcher) deliver(ctx context.Context, delivery domain.WebhookDelivery) error {
+	webhook, err := d.repo.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		var notFound *domain.NotFoundError
+		if errors.As(err, &notFound) {
+			// deleted together with its deliveries since they were read
+			return nil
+		}
+		return err
+	}
+
+	status, err := d.send(ctx, webhook, delivery)
+	if err == nil {
+		return d.repo.MarkDeliverySucceeded(ctx, delivery.ID, status, time.Now())
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= d.cfg.MaxAttempts {
+		log.Printf("webhook delivery %d is dead after %d attempts: %s", delivery.ID, attempts, err)
+		return d.repo.MarkDeliveryDead(ctx, delivery.ID, status, err.Error())
+	}
+	return d.repo.RetryDelivery(ctx, delivery.ID, status, err.Error(), time.Now().Add(backoff(d.cfg, attempts)))
+}
+
+// send posts the payload of the delivery to the webhook and returns the status code of the response, 0 when there was none.
+func (d *Dispatcher) send(ctx context.Context, webhook domain.Webhook, delivery domain.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mercari-webhook/1.0")
+	req.Header.Set(HeaderEvent, string(delivery.EventType))
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, Signature(webhook.Secret, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// read the response so that the connection is reused
+	if _, err := io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseSize)); err != nil {
+		return res.StatusCode, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// backoff is the delay before the next attempt after the failed attempts.
+func backoff(cfg config.Webhook, attempts int) time.Duration {
+	d := cfg.BaseBackoff
+	for i := 1; i < attempts && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	return d
+}
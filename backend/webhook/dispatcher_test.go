@@ -0,0 +1,339 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/config"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/db"
+	"github.com/mercari-build/mecari-build-hackathon-2023/backend/domain"
+)
+
+// fakeRepository keeps the webhooks and the deliveries in memory. The methods it doesn't override panic.
+type fakeRepository struct {
+	db.WebhookRepository
+
+	mu         sync.Mutex
+	webhooks   map[int64]domain.Webhook
+	deliveries map[int64]*fakeDelivery
+}
+
+type fakeDelivery struct {
+	domain.WebhookDelivery
+	next time.Time
+}
+
+func newFakeRepository(webhooks ...domain.Webhook) *fakeRepository {
+	r := &fakeRepository{webhooks: map[int64]domain.Webhook{}, deliveries: map[int64]*fakeDelivery{}}
+	for _, w := range webhooks {
+		r.webhooks[w.ID] = w
+	}
+	return r
+}
+
+func (r *fakeRepository) GetWebhook(ctx context.Context, id int64) (domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.webhooks[id]
+	if !ok {
+		return w, domain.NewNotFoundError("webhook not found")
+	}
+	return w, nil
+}
+
+func (r *fakeRepository) GetWebhooksByEventType(ctx context.Context, t domain.EventType) ([]domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []domain.Webhook
+	for _, w := range r.webhooks {
+		for _, et := range w.EventTypes {
+			if et == t {
+				res = append(res, w)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeRepository) AddDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range deliveries {
+		d.ID = int64(len(r.deliveries) + 1)
+		d.Status = domain.WebhookDeliveryStatusPending
+		r.deliveries[d.ID] = &fakeDelivery{WebhookDelivery: d, next: time.Now()}
+	}
+	return nil
+}
+
+func (r *fakeRepository) GetPendingDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []domain.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == domain.WebhookDeliveryStatusPending && !d.next.After(now) && len(res) < limit {
+			res = append(res, d.WebhookDelivery)
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeRepository) MarkDeliverySucceeded(ctx context.Context, id int64, responseStatus int, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.deliveries[id]
+	d.Status, d.Attempts, d.ResponseStatus = domain.WebhookDeliveryStatusSucceeded, d.Attempts+1, responseStatus
+	return nil
+}
+
+func (r *fakeRepository) RetryDelivery(ctx context.Context, id int64, responseStatus int, lastError string, next time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.deliveries[id]
+	d.Attempts, d.ResponseStatus, d.LastError, d.next = d.Attempts+1, responseStatus, lastError, next
+	return nil
+}
+
+func (r *fakeRepository) MarkDeliveryDead(ctx context.Context, id int64, responseStatus int, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.deliveries[id]
+	d.Status, d.Attempts, d.ResponseStatus, d.LastError = domain.WebhookDeliveryStatusDead, d.Attempts+1, responseStatus, lastError
+	return nil
+}
+
+func (r *fakeRepository) RedeliverDelivery(ctx context.Context, id, webhookID int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.deliveries[id]
+	if !ok || d.WebhookID != webhookID {
+		return domain.NewNotFoundError("delivery not found")
+	}
+	d.Status, d.Attempts, d.next = domain.WebhookDeliveryStatusPending, 0, at
+	return nil
+}
+
+func (r *fakeRepository) delivery(id int64) fakeDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.deliveries[id]
+}
+
+// makeDue moves the next attempt of the delivery to now instead of waiting for the backoff.
+func (r *fakeRepository) makeDue(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[id].next = time.Now()
+}
+
+var testConfig = config.Webhook{
+	Timeout:     time.Second,
+	MaxAttempts: 4,
+	BaseBackoff: time.Minute,
+	MaxBackoff:  3 * time.Minute,
+	// the test servers listen on loopback
+	AllowedPrivateNetworks: []string{"127.0.0.0/8"},
+}
+
+var sold = domain.ItemSold{ItemID: 1, Name: "shirt", Price: 500, SellerID: 2, BuyerID: 3}
+
+func TestDispatcherSignature(t *testing.T) {
+	ctx := context.Background()
+	const secret = "s3cret"
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header, body}
+	}))
+	defer srv.Close()
+
+	repo := newFakeRepository(
+		domain.Webhook{ID: 1, URL: srv.URL, EventTypes: []domain.EventType{domain.EventTypeItemSold}, Secret: secret},
+		domain.Webhook{ID: 2, URL: srv.URL, EventTypes: []domain.EventType{domain.EventTypeItemListed}, Secret: "other"},
+	)
+	d := NewDispatcher(repo, nil, testConfig)
+	if err := d.Enqueue(ctx, sold); err != nil {
+		t.Fatal(err)
+	}
+	d.sendPending(ctx)
+
+	req := <-requests
+	// verified the way a receiver would, without Signature
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get(HeaderSignature); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got, want)
+	}
+	if got := req.header.Get(HeaderEvent); got != string(domain.EventTypeItemSold) {
+		t.Errorf("%s = %q", HeaderEvent, got)
+	}
+	if got := req.header.Get(HeaderDelivery); got != "1" {
+		t.Errorf("%s = %q, want 1", HeaderDelivery, got)
+	}
+	if got := repo.delivery(1); got.Status != domain.WebhookDeliveryStatusSucceeded || got.ResponseStatus != http.StatusOK {
+		t.Errorf("delivery after 200 = %+v", got.WebhookDelivery)
+	}
+	// only the webhook subscribed to the type gets a delivery
+	if len(repo.deliveries) != 1 {
+		t.Errorf("%d deliveries, want 1", len(repo.deliveries))
+	}
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		requests atomic.Int64
+		status   atomic.Int64
+	)
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	repo := newFakeRepository(domain.Webhook{ID: 1, URL: srv.URL, EventTypes: []domain.EventType{domain.EventTypeItemSold}, Secret: "s3cret"})
+	d := NewDispatcher(repo, nil, testConfig)
+	if err := d.Enqueue(ctx, sold); err != nil {
+		t.Fatal(err)
+	}
+
+	// attempt sends the delivery once more, checks that it failed as the nth attempt and returns it
+	attempt := func(n int) fakeDelivery {
+		t.Helper()
+		sent := requests.Load()
+		d.sendPending(ctx)
+		if got := requests.Load(); got != sent+1 {
+			t.Fatalf("%d requests for attempt %d, want 1", got-sent, n)
+		}
+		got := repo.delivery(1)
+		if got.Attempts != n || got.ResponseStatus != http.StatusServiceUnavailable || got.LastError == "" {
+			t.Fatalf("delivery after attempt %d = %+v", n, got.WebhookDelivery)
+		}
+		return got
+	}
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		before := time.Now()
+		got := attempt(i + 1)
+		if got.Status != domain.WebhookDeliveryStatusPending {
+			t.Fatalf("status after attempt %d = %s, want pending", i+1, got.Status)
+		}
+		if delay := got.next.Sub(before); delay < want || delay > want+time.Second {
+			t.Errorf("next attempt %s after attempt %d, want %s", delay, i+1, want)
+		}
+
+		// not sent again before the backoff
+		d.sendPending(ctx)
+		if n := requests.Load(); n != int64(i+1) {
+			t.Fatalf("sent during the backoff: %d requests", n)
+		}
+		repo.makeDue(1)
+	}
+
+	if got := attempt(testConfig.MaxAttempts); got.Status != domain.WebhookDeliveryStatusDead {
+		t.Fatalf("status after %d attempts = %s, want dead", testConfig.MaxAttempts, got.Status)
+	}
+	d.sendPending(ctx)
+	if n := requests.Load(); n != int64(testConfig.MaxAttempts) {
+		t.Fatalf("a dead delivery was sent: %d requests", n)
+	}
+
+	// a redelivery starts over with the base backoff instead of going back to dead
+	if err := d.Redeliver(ctx, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	got := attempt(1)
+	if got.Status != domain.WebhookDeliveryStatusPending {
+		t.Fatalf("status after a failed redelivery = %s, want pending", got.Status)
+	}
+	if delay := got.next.Sub(before); delay < testConfig.BaseBackoff || delay > testConfig.BaseBackoff+time.Second {
+		t.Errorf("next attempt %s after a failed redelivery, want %s", delay, testConfig.BaseBackoff)
+	}
+
+	status.Store(http.StatusNoContent)
+	repo.makeDue(1)
+	d.sendPending(ctx)
+	if got := repo.delivery(1); got.Status != domain.WebhookDeliveryStatusSucceeded || got.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery after 204 = %+v", got.WebhookDelivery)
+	}
+
+	if err := d.Redeliver(ctx, 1, 2); err == nil {
+		t.Error("redelivered the delivery of another webhook")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 3 * time.Minute, 10: 3 * time.Minute} {
+		if got := backoff(testConfig, attempts); got != want {
+			t.Errorf("backoff after %d attempts = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestDispatcherPrivateNetworks(t *testing.T) {
+	ctx := context.Background()
+
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig
+	cfg.AllowedPrivateNetworks = nil
+	repo := newFakeRepository(domain.Webhook{ID: 1, URL: srv.URL, EventTypes: []domain.EventType{domain.EventTypeItemSold}, Secret: "s3cret"})
+	d := NewDispatcher(repo, nil, cfg)
+	if err := d.Enqueue(ctx, sold); err != nil {
+		t.Fatal(err)
+	}
+	d.sendPending(ctx)
+
+	if n := requests.Load(); n != 0 {
+		t.Errorf("%d requests reached a loopback server", n)
+	}
+	if got := repo.delivery(1); got.Attempts != 1 || !strings.Contains(got.LastError, "private address") {
+		t.Errorf("delivery to a loopback server = %+v", got.WebhookDelivery)
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	control := dialControl([]string{"10.1.0.0/16"})
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:443":     true,
+		"[2606:2800::1]:443":    true,
+		"10.1.2.3:80":           true,
+		"10.2.0.1:80":           false,
+		"127.0.0.1:80":          false,
+		"172.16.0.1:80":         false,
+		"192.168.1.1:80":        false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"[::1]:80":              false,
+		"[::ffff:127.0.0.1]:80": false,
+		"[fd00::1]:80":          false,
+		"[fe80::1]:80":          false,
+	} {
+		if err := control("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("dial %s: err = %v, want allowed %t", address, err, allowed)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestWebhookAuditTrail(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.registerAdmin("admin")
+
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	s.mustDo(http.MethodPost, "/webhooks", admin, map[string]any{
+		"url":         "https://example.com/hooks",
+		"event_types": []string{"item_sold"},
+		"secret":      "0123456789abcdef",
+	}, &created)
+	s.mustDo(http.MethodDelete, fmt.Sprintf("/webhooks/%d", created.ID), admin, nil, nil)
+	if code := s.do(http.MethodDelete, fmt.Sprintf("/webhooks/%d", created.ID), admin, nil, nil); code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", code)
+	}
+
+	var logs []struct {
+		Action   string `json:"action"`
+		TargetID int64  `json:"target_id"`
+	}
+	s.mustDo(http.MethodGet, "/admin/audit-logs", admin, nil, &logs)
+	want := fmt.Sprintf("[{Action:delete_webhook TargetID:%[1]d} {Action:create_webhook TargetID:%[1]d}]", created.ID)
+	if got := fmt.Sprintf("%+v", logs); got != want {
+		t.Errorf("audit logs = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"sync"
+)
+
+// Queue hands values over to a worker without ever blocking the sender.
+type Queue[T any] struct {
+	mu     sync.Mutex
+	values []T
+	// max is the number of values queued at most, 0 for no bound
+	max int
+	// wake has a buffer of one, so that Push never blocks and Run wakes up once for any number of values
+	wake chan struct{}
+}
+
+// NewQueue returns a queue without a bound.
+func NewQueue[T any]() *Queue[T] {
+	return &Queue[T]{wake: make(chan struct{}, 1)}
+}
+
+// NewBoundedQueue returns a queue which drops the values pushed while max values are waiting,
+// for senders which must not be able to grow it without limit.
+func NewBoundedQueue[T any](max int) *Queue[T] {
+	return &Queue[T]{wake: make(chan struct{}, 1), max: max}
+}
+
+// Push queues v and reports whether it was queued. It is dropped when the queue is full.
+func (q *Queue[T]) Push(v T) bool {
+	q.mu.Lock()
+	if q.max > 0 && len(q.values) >= q.max {
+		q.mu.Unlock()
+		return false
+	}
+	q.values = append(q.values, v)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Run calls fn with the pushed values in order until ctx is done.
+// The values still queued then are handled before it returns, with a context which is not canceled.
+func (q *Queue[T]) Run(ctx context.Context, fn func(ctx context.Context, v T)) {
+	for {
+		select {
+		case <-q.wake:
+			q.drain(ctx, fn)
+		case <-ctx.Done():
+			// the DB is closed only after the workers are done
+			q.drain(context.Background(), fn)
+			return
+		}
+	}
+}
+
+func (q *Queue[T]) drain(ctx context.Context, fn func(ctx context.Context, v T)) {
+	q.mu.Lock()
+	values := q.values
+	q.values = nil
+	q.mu.Unlock()
+
+	for _, v := range values {
+		fn(ctx, v)
+	}
+}
@@ -0,0 +1,46 @@
+// Package worker runs background jobs which have to finish before the process exits.
+package worker
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs goroutines sharing a context which is canceled on Shutdown.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine. fn should return soon after ctx is done.
+func (g *Group) Go(fn func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn(g.ctx)
+	}()
+}
+
+// Shutdown cancels the workers and waits for them until ctx is done.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -4,6 +4,7 @@ import { useCookies } from "react-cookie";
 import { MerComponent } from "../MerComponent";
 import { toast } from "react-toastify";
 import { fetcher, fetcherBlob } from "../../helper";
+import { server } from "../../common/constants";
 
 const ItemStatus = {
   ItemStatusInitial: 1,
@@ -77,7 +78,7 @@ export const ItemDetail = () => {
         user_id: Number(cookies.userID),
       }),
     })
-      .then((_) => window.location.reload())
+      .then((_) => fetchItem())
       .catch((err) => {
         console.log(`POST error:`, err);
         toast.error(err.message);
@@ -88,6 +89,21 @@ export const ItemDetail = () => {
     fetchItem();
   }, []);
 
+  // The status of the item is pushed by the server instead of reloading the page
+  useEffect(() => {
+    if (!cookies.token) {
+      return;
+    }
+    const events = new EventSource(`${server}/events?token=${cookies.token}`);
+    events.addEventListener("item", (e) => {
+      const data = JSON.parse((e as MessageEvent).data);
+      if (data.id === Number(params.id)) {
+        setItem((item) => item && { ...item, status: data.status });
+      }
+    });
+    return () => events.close();
+  }, [cookies.token, params.id]);
+
   return (
     <div className="ItemDetail">
       <MerComponent condition={() => item !== undefined}>